@@ -9,33 +9,87 @@ import (
 
 type Stmt interface {
 	stmtNode()
+	Pos() int
 }
 
 type ExprStmt struct {
 	Expression Expr
+	Line       int
 }
 
 type LetStmt struct {
 	Name  *IdentExpr
 	Value Expr
+	Line  int
 }
 
 type AssignStmt struct {
 	Name  Expr
 	Value Expr
+	Line  int
 }
 
 type BlockStmt struct {
 	Stmts []Stmt
+	Line  int
+	End   int
 }
 
 type PrintStmt struct {
 	Expr Expr
+	Line int
 }
 
 type FuncStmt struct {
 	Name     *IdentExpr
 	FuncExpr *FuncExpr
+	Line     int
+}
+
+type ReturnStmt struct {
+	Value Expr
+	Line  int
+}
+
+// ForInStmt runs Body once for each value produced by iterating over
+// Iterable, with the value bound to Name.
+type ForInStmt struct {
+	Name     *IdentExpr
+	Iterable Expr
+	Body     *BlockStmt
+	Line     int
+}
+
+type ThrowStmt struct {
+	Value Expr
+	Line  int
+}
+
+// TryStmt runs Body and, if it throws, Catch with the error bound to
+// CatchName. Finally runs however the statement is left. Catch or Finally
+// may be nil, but not both; CatchName is nil when the error is not bound.
+type TryStmt struct {
+	Body      *BlockStmt
+	CatchName *IdentExpr
+	Catch     *BlockStmt
+	Finally   *BlockStmt
+	Line      int
+}
+
+// ImportStmt binds the module loaded from Path to Name, which is the last
+// element of the path unless the import gives one.
+type ImportStmt struct {
+	Name  *IdentExpr
+	Path  string
+	Alias bool
+	Line  int
+}
+
+// ExportStmt declares Decl, a LetStmt or FuncStmt, and exports it from the
+// module.
+type ExportStmt struct {
+	Decl Stmt
+	Line int
 }
 
 func (*ExprStmt) stmtNode()   {}
@@ -44,6 +98,25 @@ func (*AssignStmt) stmtNode() {}
 func (*BlockStmt) stmtNode()  {}
 func (*PrintStmt) stmtNode()  {}
 func (*FuncStmt) stmtNode()   {}
+func (*ReturnStmt) stmtNode() {}
+func (*ForInStmt) stmtNode()  {}
+func (*ThrowStmt) stmtNode()  {}
+func (*TryStmt) stmtNode()    {}
+func (*ImportStmt) stmtNode() {}
+func (*ExportStmt) stmtNode() {}
+
+func (s *ExprStmt) Pos() int   { return s.Line }
+func (s *LetStmt) Pos() int    { return s.Line }
+func (s *AssignStmt) Pos() int { return s.Line }
+func (s *BlockStmt) Pos() int  { return s.Line }
+func (s *PrintStmt) Pos() int  { return s.Line }
+func (s *FuncStmt) Pos() int   { return s.Line }
+func (s *ReturnStmt) Pos() int { return s.Line }
+func (s *ForInStmt) Pos() int  { return s.Line }
+func (s *ThrowStmt) Pos() int  { return s.Line }
+func (s *TryStmt) Pos() int    { return s.Line }
+func (s *ImportStmt) Pos() int { return s.Line }
+func (s *ExportStmt) Pos() int { return s.Line }
 
 func (e *ExprStmt) String() string {
 	return fmt.Sprintf("%s;\n", e.Expression)
@@ -91,6 +164,46 @@ func (f *FuncStmt) String() string {
 	return fmt.Sprintf("function %s%s\n", f.Name, f.FuncExpr.String()[3:])
 }
 
+func (r *ReturnStmt) String() string {
+	return fmt.Sprintf("return %s;\n", r.Value)
+}
+
+func (f *ForInStmt) String() string {
+	return fmt.Sprintf("for %s in %s %s", f.Name, f.Iterable, f.Body)
+}
+
+func (t *ThrowStmt) String() string {
+	return fmt.Sprintf("throw %s;\n", t.Value)
+}
+
+func (t *TryStmt) String() string {
+	var sb strings.Builder
+	sb.WriteString("try " + strings.TrimSuffix(t.Body.String(), "\n"))
+	if t.Catch != nil {
+		sb.WriteString(" catch ")
+		if t.CatchName != nil {
+			sb.WriteString("(" + t.CatchName.Name + ") ")
+		}
+		sb.WriteString(strings.TrimSuffix(t.Catch.String(), "\n"))
+	}
+	if t.Finally != nil {
+		sb.WriteString(" finally " + strings.TrimSuffix(t.Finally.String(), "\n"))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func (i *ImportStmt) String() string {
+	if i.Alias {
+		return fmt.Sprintf("import %s \"%s\";\n", i.Name, i.Path)
+	}
+	return fmt.Sprintf("import \"%s\";\n", i.Path)
+}
+
+func (e *ExportStmt) String() string {
+	return fmt.Sprintf("export %s", e.Decl)
+}
+
 type Expr interface {
 	exprNode()
 }
@@ -122,6 +235,10 @@ type IdentExpr struct {
 	Name string
 }
 
+type BoolLit struct {
+	Value bool
+}
+
 type NilExpr struct{}
 
 type CallExpr struct {
@@ -129,6 +246,11 @@ type CallExpr struct {
 	Args   []Expr
 }
 
+type GetExpr struct {
+	Object Expr
+	Name   *IdentExpr
+}
+
 type FuncExpr struct {
 	Params []*IdentExpr
 	Body   *BlockStmt
@@ -140,8 +262,10 @@ func (g *GroupExpr) exprNode()  {}
 func (n *NumberLit) exprNode()  {}
 func (s *StringLit) exprNode()  {}
 func (i *IdentExpr) exprNode()  {}
+func (b *BoolLit) exprNode()    {}
 func (n *NilExpr) exprNode()    {}
 func (c *CallExpr) exprNode()   {}
+func (g *GetExpr) exprNode()    {}
 func (f *FuncExpr) exprNode()   {}
 
 func (b *BinaryExpr) String() string {
@@ -168,6 +292,10 @@ func (i *IdentExpr) String() string {
 	return i.Name
 }
 
+func (b *BoolLit) String() string {
+	return fmt.Sprintf("%t", b.Value)
+}
+
 func (n *NilExpr) String() string {
 	return "<nil>"
 }
@@ -181,6 +309,10 @@ func (c *CallExpr) String() string {
 	return fmt.Sprintf("%s(%s)", c.Callee, strings.Join(args, ","))
 }
 
+func (g *GetExpr) String() string {
+	return fmt.Sprintf("%s.%s", g.Object, g.Name)
+}
+
 func (f *FuncExpr) String() string {
 	var params []string
 	for _, p := range f.Params {
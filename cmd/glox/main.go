@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sushil-cmd-r/glox/dap"
+	"github.com/sushil-cmd-r/glox/format"
+	"github.com/sushil-cmd-r/glox/repl"
+	"github.com/sushil-cmd-r/glox/vm"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	exitSyntax  = 65
+	exitCompile = 66
+	exitRuntime = 70
+)
+
+const usage = `usage: glox <command> [arguments]
+
+commands:
+  run [-dis] [-trace] [-O0] [-profile] [-pprof file] [-cover file]
+      [-chrometrace file] file [args...]
+                                  compile and run a script
+  repl                            start an interactive session
+  dap                             serve the Debug Adapter Protocol on stdio
+  build [-O0] [-o out] file       compile a script to bytecode
+  disasm [-O0] [-json] file       print the bytecode of a script
+  cover file.lcov...              print scripts annotated with line coverage
+  check file...                   parse and compile scripts without running them
+  fmt [-w] file...                print scripts in canonical form
+
+A file named - is read from stdin. Arguments after the script file are
+available to it as the global list args. run and disasm also accept
+bytecode written by build, which is detected by its header.
+
+Imported files are looked up next to the importing script and then in the
+directories listed in the GLOXPATH environment variable.
+
+exit codes:
+  1   i/o error
+  2   usage error
+  65  syntax error
+  66  compile error
+  70  runtime error
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "run":
+		return runCmd(args)
+	case "repl":
+		machine := vm.Init(false)
+		machine.SetImportPath(importPath()...)
+		repl.Run(machine, os.Stdin, os.Stdout)
+		return exitOK
+	case "dap":
+		return report(dap.Serve(os.Stdin, os.Stdout))
+	case "build":
+		return buildCmd(args)
+	case "disasm":
+		return disasmCmd(args)
+	case "cover":
+		return coverCmd(args)
+	case "check":
+		return checkCmd(args)
+	case "fmt":
+		return fmtCmd(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "glox: unknown command %q\n\n%s", cmd, usage)
+		return exitUsage
+	}
+}
+
+func runCmd(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	dis := fs.Bool("dis", false, "print bytecode before running")
+	trace := fs.Bool("trace", false, "print each instruction and the stack as it runs")
+	noOpt := fs.Bool("O0", false, "disable optimisations")
+	profile := fs.Bool("profile", false, "print an execution profile to stderr")
+	pprof := fs.String("pprof", "", "write an execution profile in pprof format to `file`")
+	cover := fs.String("cover", "", "record line coverage in LCOV `file`, merging with its contents")
+	chrome := fs.String("chrometrace", "", "write a Chrome trace of function calls to `file`")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: glox run [-dis] [-trace] [-O0] [-profile] [-pprof file] [-cover file] [-chrometrace file] file [args...]")
+		return exitUsage
+	}
+
+	src, err := readSource(fs.Arg(0))
+	if err != nil {
+		return report(err)
+	}
+
+	machine := vm.Init(false)
+	machine.SetOptions(vm.Options{Debug: *trace, NoFold: *noOpt, NoPeephole: *noOpt})
+	machine.SetImportPath(importPath()...)
+	scriptArgs, err := obj.FromGo(fs.Args()[1:])
+	if err != nil {
+		return report(err)
+	}
+	machine.SetGlobal("args", scriptArgs)
+
+	var prof *vm.Profile
+	if *profile || *pprof != "" {
+		prof = vm.NewProfile()
+		prof.File = fs.Arg(0)
+		machine.SetProfile(prof)
+	}
+
+	var cov *vm.Coverage
+	if *cover != "" {
+		cov = vm.NewCoverage()
+		machine.SetCoverage(cov, fs.Arg(0))
+	}
+
+	var chromeTrace *vm.ChromeTrace
+	if *chrome != "" {
+		chromeTrace = vm.NewChromeTrace()
+		machine.SetChromeTrace(chromeTrace)
+	}
+
+	var fn *obj.Function
+	if obj.IsBytecode(src) {
+		if fn, err = machine.Load(src); err == nil {
+			fn.SetFile(fs.Arg(0))
+		}
+	} else {
+		fn, err = machine.CompileFile(fs.Arg(0), src)
+	}
+
+	if err == nil {
+		if *dis {
+			obj.WriteText(os.Stdout, fn)
+		}
+		err = machine.Run(fn)
+	}
+
+	code := report(err)
+	if prof != nil {
+		machine.SetProfile(nil)
+		code = max(code, writeProfile(prof, *profile, *pprof))
+	}
+	if cov != nil {
+		code = max(code, report(writeCoverage(cov, *cover)))
+	}
+	if chromeTrace != nil {
+		code = max(code, report(writeFile(*chrome, chromeTrace.WriteJSON)))
+	}
+
+	return code
+}
+
+// writeCoverage merges cov into the LCOV file name, creating it if needed.
+func writeCoverage(cov *vm.Coverage, name string) error {
+	f, err := os.Open(name)
+	if err == nil {
+		prev, err := vm.ReadLCOV(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		cov.Merge(prev)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := cov.WriteLCOV(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(name, buf.Bytes(), 0o644)
+}
+
+func coverCmd(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: glox cover file.lcov...")
+		return exitUsage
+	}
+
+	cov := vm.NewCoverage()
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			return report(err)
+		}
+		c, err := vm.ReadLCOV(f)
+		f.Close()
+		if err != nil {
+			return report(fmt.Errorf("%s: %w", name, err))
+		}
+		cov.Merge(c)
+	}
+
+	code := exitOK
+	for i, file := range slices.Sorted(maps.Keys(cov.Files)) {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		src, err := os.ReadFile(file)
+		if err == nil {
+			err = cov.WriteAnnotated(os.Stdout, file, src)
+		}
+		if err != nil {
+			code = max(code, report(err))
+		}
+	}
+
+	return code
+}
+
+func writeProfile(prof *vm.Profile, text bool, pprof string) int {
+	if text {
+		if err := prof.WriteText(os.Stderr); err != nil {
+			return report(err)
+		}
+	}
+
+	if pprof == "" {
+		return exitOK
+	}
+	return report(writeFile(pprof, prof.WritePprof))
+}
+
+// writeFile creates the file name and fills it using write.
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func buildCmd(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	noOpt := fs.Bool("O0", false, "disable optimisations")
+	output := fs.String("o", "", "output file (default: file with a .gloxc extension)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: glox build [-O0] [-o out] file")
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+	out := *output
+	if out == "" {
+		if name == "-" {
+			fmt.Fprintln(os.Stderr, "glox build: -o is required when reading stdin")
+			return exitUsage
+		}
+		out = strings.TrimSuffix(name, filepath.Ext(name)) + ".gloxc"
+	}
+
+	src, err := readSource(name)
+	if err != nil {
+		return report(err)
+	}
+
+	fn, err := vm.CompileSource(src, vm.Options{NoFold: *noOpt, NoPeephole: *noOpt})
+	if err != nil {
+		return report(err)
+	}
+
+	data, err := obj.Marshal(fn)
+	if err != nil {
+		return report(err)
+	}
+
+	if out == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(out, data, 0o644)
+	}
+	return report(err)
+}
+
+func disasmCmd(args []string) int {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	noOpt := fs.Bool("O0", false, "disable optimisations")
+	asJSON := fs.Bool("json", false, "print the bytecode as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: glox disasm [-O0] [-json] file")
+		return exitUsage
+	}
+
+	src, err := readSource(fs.Arg(0))
+	if err != nil {
+		return report(err)
+	}
+
+	var fn *obj.Function
+	if obj.IsBytecode(src) {
+		fn, err = vm.Init(false).Load(src)
+	} else {
+		fn, err = vm.CompileSource(src, vm.Options{NoFold: *noOpt, NoPeephole: *noOpt})
+	}
+	if err != nil {
+		return report(err)
+	}
+
+	if *asJSON {
+		return report(obj.WriteJSON(os.Stdout, fn))
+	}
+	return report(obj.WriteText(os.Stdout, fn))
+}
+
+func checkCmd(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: glox check file...")
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, name := range args {
+		src, err := readSource(name)
+		if err == nil {
+			_, err = vm.CompileSource(src, vm.Options{})
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: ", name)
+			code = max(code, report(err))
+		}
+	}
+
+	return code
+}
+
+func fmtCmd(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := fs.Bool("w", false, "write result to the source file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: glox fmt [-w] file...")
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, name := range fs.Args() {
+		src, err := readSource(name)
+		if err != nil {
+			code = max(code, report(err))
+			continue
+		}
+
+		out, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: ", name)
+			code = max(code, report(&vm.Error{Kind: vm.SyntaxError, Err: err}))
+			continue
+		}
+
+		if *write && name != "-" {
+			err = os.WriteFile(name, out, 0o644)
+		} else {
+			_, err = os.Stdout.Write(out)
+		}
+
+		if err != nil {
+			code = max(code, report(err))
+		}
+	}
+
+	return code
+}
+
+// importPath returns the directories listed in GLOXPATH.
+func importPath() []string {
+	return filepath.SplitList(os.Getenv("GLOXPATH"))
+}
+
+func readSource(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(name)
+}
+
+// report prints err to stderr and returns the exit code for it.
+func report(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	fmt.Fprintln(os.Stderr, err)
+
+	var thrown *obj.Error
+	if errors.As(err, &thrown) {
+		for _, frame := range thrown.Trace() {
+			fmt.Fprintln(os.Stderr, "\tat", frame)
+		}
+	}
+
+	var vmErr *vm.Error
+	if !errors.As(err, &vmErr) {
+		return exitFailure
+	}
+
+	switch vmErr.Kind {
+	case vm.SyntaxError:
+		return exitSyntax
+	case vm.CompileError:
+		return exitCompile
+	default:
+		return exitRuntime
+	}
+}
@@ -0,0 +1,126 @@
+// Package dap implements a Debug Adapter Protocol server for glox scripts.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// message is the common shape of requests, responses and events. Only the
+// fields relevant to the message type are set.
+type message struct {
+	Seq  int    `json:"seq"`
+	Type string `json:"type"`
+
+	Command   string          `json:"command,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+
+	RequestSeq int    `json:"request_seq,omitempty"`
+	Success    *bool  `json:"success,omitempty"`
+	Message    string `json:"message,omitempty"`
+
+	Event string `json:"event,omitempty"`
+	Body  any    `json:"body,omitempty"`
+}
+
+var errNoContentLength = errors.New("dap: missing Content-Length header")
+
+// readMessage reads a message framed by a Content-Length header.
+func readMessage(r *bufio.Reader) (*message, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	value := header.Get("Content-Length")
+	if value == "" {
+		return nil, errNoContentLength
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("dap: invalid Content-Length %q", value)
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("dap: %w", err)
+	}
+
+	return &msg, nil
+}
+
+func writeMessage(w io.Writer, msg *message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type launchArguments struct {
+	Program     string   `json:"program"`
+	Args        []string `json:"args"`
+	StopOnEntry bool     `json:"stopOnEntry"`
+	NoDebug     bool     `json:"noDebug"`
+}
+
+type setBreakpointsArguments struct {
+	Source      source `json:"source"`
+	Breakpoints []struct {
+		Line int `json:"line"`
+	} `json:"breakpoints"`
+	Lines []int `json:"lines"`
+}
+
+type breakpoint struct {
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line"`
+	Source   source `json:"source"`
+}
+
+type stackFrame struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Source source `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+type scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type thread struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
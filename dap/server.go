@@ -0,0 +1,489 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/sushil-cmd-r/glox/vm"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// threadID is the id reported for the single thread a script runs on.
+const threadID = 1
+
+// globalsRef is the variables reference of the globals scope. The locals of
+// frame n use n+firstLocalsRef and expanded values are numbered after those.
+const (
+	globalsRef     = 1
+	firstLocalsRef = 2
+)
+
+// Server is a debug adapter for a single debug session. It launches one
+// script per session and runs it on its own goroutine.
+type Server struct {
+	r *bufio.Reader
+
+	wmu sync.Mutex
+	w   io.Writer
+	seq int
+
+	machine *vm.VM
+	dbg     *vm.Debugger
+	launch  *launchArguments
+	ready   bool
+
+	// mu guards paused and aborting, which are shared with the goroutine
+	// running the script.
+	mu       sync.Mutex
+	paused   bool
+	aborting bool
+
+	// While the script is paused its goroutine waits for an action on resume
+	// and runs functions sent on inspect, so that the debugger is only used
+	// from that goroutine.
+	resume  chan vm.Action
+	inspect chan func(*vm.Debugger)
+	done    chan struct{}
+
+	// next is the action to resume with once the response to the request
+	// that asked for it has been sent.
+	next *vm.Action
+
+	// refs maps variable references handed out while paused to the values
+	// they expand.
+	refs map[int]obj.Obj
+}
+
+func NewServer(r io.Reader, w io.Writer) *Server {
+	s := &Server{
+		r:       bufio.NewReader(r),
+		w:       w,
+		resume:  make(chan vm.Action),
+		inspect: make(chan func(*vm.Debugger)),
+		refs:    make(map[int]obj.Obj),
+	}
+
+	// Breakpoints may be set before the script is launched, so the debugger
+	// exists for the whole session.
+	s.dbg = vm.NewDebugger(s.stopped)
+	return s
+}
+
+// Serve handles requests until the client disconnects or r is closed.
+func Serve(r io.Reader, w io.Writer) error {
+	return NewServer(r, w).Serve()
+}
+
+func (s *Server) Serve() error {
+	for {
+		req, err := readMessage(s.r)
+		if errors.Is(err, io.EOF) {
+			s.abort()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if req.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(req)
+		if err != nil {
+			s.respondError(req, err)
+		} else {
+			s.respond(req, body)
+		}
+
+		if s.next != nil {
+			s.resume <- *s.next
+			s.next = nil
+		}
+
+		switch req.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "launch", "configurationDone":
+			s.start()
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req *message) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsTerminateRequest":         true,
+		}, nil
+
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.prepare(&args)
+
+	case "configurationDone":
+		s.ready = true
+		return nil, nil
+
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(&args), nil
+
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []breakpoint{}}, nil
+
+	case "threads":
+		return map[string]any{"threads": []thread{{ID: threadID, Name: "main"}}}, nil
+
+	case "stackTrace":
+		return s.stackTrace()
+
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"scopes": []scope{
+			{Name: "Locals", VariablesReference: args.FrameID + firstLocalsRef},
+			{Name: "Globals", VariablesReference: globalsRef},
+		}}, nil
+
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.continueWith(vm.Continue)
+	case "next":
+		return nil, s.continueWith(vm.StepOver)
+	case "stepIn":
+		return nil, s.continueWith(vm.StepInto)
+	case "stepOut":
+		return nil, s.continueWith(vm.StepOut)
+
+	case "pause":
+		s.dbg.Pause()
+		return nil, nil
+
+	case "disconnect", "terminate":
+		s.abort()
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported request %q", req.Command)
+	}
+}
+
+func (s *Server) prepare(args *launchArguments) error {
+	if s.launch != nil {
+		return errors.New("a script is already launched")
+	}
+	if args.Program == "" {
+		return errors.New("launch: program is required")
+	}
+
+	program, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	args.Program = program
+
+	machine := vm.Init(false)
+	machine.SetOutput(&outputWriter{s: s, category: "stdout"})
+
+	if args.Args == nil {
+		args.Args = []string{}
+	}
+	scriptArgs, err := obj.FromGo(args.Args)
+	if err != nil {
+		return err
+	}
+	machine.SetGlobal("args", scriptArgs)
+
+	// The debugger stays attached without debugging so that the script can
+	// still be paused to stop it.
+	if args.StopOnEntry && !args.NoDebug {
+		s.dbg.Pause()
+	}
+	machine.SetDebugger(s.dbg)
+
+	s.machine, s.launch = machine, args
+	return nil
+}
+
+// start runs the launched script once the client has finished configuring
+// breakpoints.
+func (s *Server) start() {
+	if s.launch == nil || !s.ready || s.done != nil {
+		return
+	}
+
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+
+		code := 0
+		src, err := os.ReadFile(s.launch.Program)
+		if err == nil {
+			err = s.machine.ExecuteFile(s.launch.Program, src)
+		}
+		if err != nil && !errors.Is(err, vm.ErrAborted) {
+			s.event("output", map[string]any{"category": "stderr", "output": err.Error() + "\n"})
+			code = 1
+		}
+
+		s.event("exited", map[string]any{"exitCode": code})
+		s.event("terminated", nil)
+	}()
+}
+
+// stopped is the debugger handler. It runs on the script's goroutine.
+func (s *Server) stopped(d *vm.Debugger, stop vm.Stop) vm.Action {
+	s.mu.Lock()
+	if s.aborting {
+		s.mu.Unlock()
+		return vm.Abort
+	}
+	if s.launch.NoDebug {
+		s.mu.Unlock()
+		return vm.Continue
+	}
+	s.paused = true
+	s.mu.Unlock()
+
+	reason := stop.Reason.String()
+	if stop.Reason == vm.StopPause && s.launch.StopOnEntry {
+		reason, s.launch.StopOnEntry = "entry", false
+	}
+	s.event("stopped", map[string]any{
+		"reason":            reason,
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	})
+
+	for {
+		select {
+		case action := <-s.resume:
+			return action
+		case f := <-s.inspect:
+			f(d)
+		}
+	}
+}
+
+// continueWith arranges for the paused script to resume with action after
+// the current request is answered.
+func (s *Server) continueWith(action vm.Action) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.paused {
+		return errors.New("not paused")
+	}
+	s.paused = false
+	clear(s.refs)
+
+	s.next = &action
+	return nil
+}
+
+// abort stops the script, if it is running, and waits for it to finish.
+func (s *Server) abort() {
+	s.mu.Lock()
+	s.aborting = true
+	paused := s.paused
+	s.paused = false
+	s.mu.Unlock()
+
+	if s.done == nil {
+		return
+	}
+
+	if paused {
+		s.resume <- vm.Abort
+	} else {
+		s.dbg.Pause()
+	}
+	<-s.done
+}
+
+// withDebugger runs f on the script's goroutine while it is paused.
+func (s *Server) withDebugger(f func(d *vm.Debugger) error) error {
+	s.mu.Lock()
+	paused := s.paused
+	s.mu.Unlock()
+
+	if !paused {
+		return errors.New("not paused")
+	}
+
+	errc := make(chan error)
+	s.inspect <- func(d *vm.Debugger) { errc <- f(d) }
+	return <-errc
+}
+
+func (s *Server) setBreakpoints(args *setBreakpointsArguments) any {
+	path := args.Source.Path
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	lines := args.Lines
+	if len(args.Breakpoints) > 0 {
+		lines = lines[:0]
+		for _, bp := range args.Breakpoints {
+			lines = append(lines, bp.Line)
+		}
+	}
+
+	bps := make([]breakpoint, 0, len(lines))
+	s.dbg.ClearBreakpoints(path)
+	for _, line := range lines {
+		s.dbg.SetBreakpoint(path, line)
+		bps = append(bps, breakpoint{Verified: true, Line: line, Source: args.Source})
+	}
+
+	return map[string]any{"breakpoints": bps}
+}
+
+func (s *Server) stackTrace() (any, error) {
+	var frames []stackFrame
+	err := s.withDebugger(func(d *vm.Debugger) error {
+		for i, f := range d.Frames() {
+			name := f.Function.Name()
+			if name == vm.InitFunc {
+				name = "script"
+			}
+
+			frames = append(frames, stackFrame{
+				ID:     i,
+				Name:   name,
+				Source: source{Name: filepath.Base(f.File), Path: f.File},
+				Line:   f.Line,
+				Column: 1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) variables(ref int) (any, error) {
+	var vars []variable
+	err := s.withDebugger(func(d *vm.Debugger) error {
+		switch {
+		case ref == globalsRef:
+			for _, v := range d.Globals() {
+				vars = append(vars, s.variable(v.Name, v.Value))
+			}
+
+		case s.refs[ref] != nil:
+			switch o := s.refs[ref].(type) {
+			case *obj.List:
+				for i, e := range obj.AsList(o) {
+					vars = append(vars, s.variable(strconv.Itoa(i), e))
+				}
+			case *obj.Map:
+				entries := obj.AsMap(o)
+				for _, k := range o.Keys() {
+					vars = append(vars, s.variable(k, entries[k]))
+				}
+			}
+
+		default:
+			locals, err := d.Locals(ref - firstLocalsRef)
+			if err != nil {
+				return err
+			}
+			for _, v := range locals {
+				vars = append(vars, s.variable(v.Name, v.Value))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if vars == nil {
+		vars = []variable{}
+	}
+	return map[string]any{"variables": vars}, nil
+}
+
+func (s *Server) variable(name string, value obj.Obj) variable {
+	v := variable{Name: name, Value: value.String(), Type: value.Type().String()}
+
+	switch value.Type() {
+	case obj.StringObj:
+		v.Value = strconv.Quote(obj.AsStr(value))
+	case obj.ListObj, obj.MapObj:
+		// References are numbered above the locals of any possible frame.
+		ref := firstLocalsRef + 1<<16 + len(s.refs)
+		s.refs[ref] = value
+		v.VariablesReference = ref
+	}
+
+	return v
+}
+
+func (s *Server) respond(req *message, body any) {
+	ok := true
+	s.send(&message{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &ok, Body: body})
+}
+
+func (s *Server) respondError(req *message, err error) {
+	ok := false
+	s.send(&message{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &ok, Message: err.Error()})
+}
+
+func (s *Server) event(name string, body any) {
+	s.send(&message{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) send(msg *message) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.seq += 1
+	msg.Seq = s.seq
+	writeMessage(s.w, msg)
+}
+
+// outputWriter forwards script output to the client as output events.
+type outputWriter struct {
+	s        *Server
+	category string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.s.event("output", map[string]any{"category": w.category, "output": string(p)})
+	return len(p), nil
+}
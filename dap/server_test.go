@@ -0,0 +1,244 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client drives a Server over a pair of pipes, the way an editor would.
+type client struct {
+	t    *testing.T
+	w    io.Writer
+	seq  int
+	msgs chan *message
+
+	// pending holds messages read while waiting for another one.
+	pending []*message
+	output  strings.Builder
+}
+
+func newClient(t *testing.T) (*client, chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	c := &client{t: t, w: inW, msgs: make(chan *message, 64)}
+
+	// Messages are read as they arrive, so that the server never blocks
+	// writing an event while the client writes a request.
+	go func() {
+		r := bufio.NewReader(outR)
+		for {
+			msg, err := readMessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(inR, outW)
+		outW.Close()
+	}()
+
+	return c, served
+}
+
+// request sends command and returns the body of its successful response.
+func (c *client) request(command string, args any) map[string]any {
+	c.t.Helper()
+
+	c.seq += 1
+	seq := c.seq
+	raw, err := json.Marshal(args)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := writeMessage(c.w, &message{Seq: seq, Type: "request", Command: command, Arguments: raw}); err != nil {
+		c.t.Fatal(err)
+	}
+
+	resp := c.wait(command+" response", func(m *message) bool {
+		return m.Type == "response" && m.RequestSeq == seq
+	})
+	if resp.Success == nil || !*resp.Success {
+		c.t.Fatalf("%s failed: %s", command, resp.Message)
+	}
+	return body(resp)
+}
+
+// event waits for the event name and returns its body.
+func (c *client) event(name string) map[string]any {
+	c.t.Helper()
+
+	return body(c.wait(name+" event", func(m *message) bool {
+		return m.Type == "event" && m.Event == name
+	}))
+}
+
+// wait returns the first message for which match is true. Output events are
+// collected as they go by.
+func (c *client) wait(what string, match func(*message) bool) *message {
+	c.t.Helper()
+
+	for i, m := range c.pending {
+		if match(m) {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return m
+		}
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-c.msgs:
+			if !ok {
+				c.t.Fatalf("connection closed waiting for %s", what)
+			}
+			if m.Type == "event" && m.Event == "output" {
+				c.output.WriteString(body(m)["output"].(string))
+				continue
+			}
+			if match(m) {
+				return m
+			}
+			c.pending = append(c.pending, m)
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func body(m *message) map[string]any {
+	b, _ := m.Body.(map[string]any)
+	return b
+}
+
+// frames returns the names and lines of the paused script's stack.
+func (c *client) frames() []stackFrame {
+	c.t.Helper()
+
+	var frames []stackFrame
+	remarshal(c.t, c.request("stackTrace", map[string]any{"threadId": threadID})["stackFrames"], &frames)
+	return frames
+}
+
+// locals returns the locals of the innermost frame by name.
+func (c *client) locals() map[string]string {
+	c.t.Helper()
+
+	var vars []variable
+	remarshal(c.t, c.request("variables", map[string]any{"variablesReference": firstLocalsRef})["variables"], &vars)
+
+	locals := make(map[string]string)
+	for _, v := range vars {
+		locals[v.Name] = v.Value
+	}
+	return locals
+}
+
+func remarshal(t *testing.T, from, to any) {
+	t.Helper()
+
+	data, err := json.Marshal(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, to); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *client) stopped(reason, function string, line int) {
+	c.t.Helper()
+
+	if got := c.event("stopped")["reason"]; got != reason {
+		c.t.Fatalf("stopped for %v, want %s", got, reason)
+	}
+
+	frames := c.frames()
+	if len(frames) == 0 {
+		c.t.Fatal("no stack frames")
+	}
+	if top := frames[0]; top.Name != function || top.Line != line {
+		c.t.Fatalf("stopped in %s at line %d, want %s at line %d", top.Name, top.Line, function, line)
+	}
+}
+
+func TestSession(t *testing.T) {
+	src := `function add(a, b) {
+  let sum = a + b
+  return sum
+}
+let x = add(1, 2)
+print x
+print add(x, 4)
+`
+	program := filepath.Join(t.TempDir(), "add.glox")
+	if err := os.WriteFile(program, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, served := newClient(t)
+
+	c.request("initialize", map[string]any{"adapterID": "glox"})
+	c.event("initialized")
+	c.request("launch", map[string]any{"program": program})
+
+	resp := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []map[string]any{{"line": 2}},
+	})
+	var bps []breakpoint
+	remarshal(t, resp["breakpoints"], &bps)
+	if len(bps) != 1 || !bps[0].Verified || bps[0].Line != 2 {
+		t.Fatalf("got breakpoints %+v", bps)
+	}
+
+	c.request("configurationDone", nil)
+
+	c.stopped("breakpoint", "add", 2)
+	if frames := c.frames(); len(frames) != 2 || frames[1].Name != "script" || frames[1].Line != 5 {
+		t.Fatalf("got frames %+v", frames)
+	}
+	if locals := c.locals(); locals["a"] != "1" || locals["b"] != "2" {
+		t.Fatalf("got locals %v", locals)
+	}
+
+	c.request("next", map[string]any{"threadId": threadID})
+	c.stopped("step", "add", 3)
+	if locals := c.locals(); locals["sum"] != "3" {
+		t.Fatalf("got locals %v", locals)
+	}
+
+	c.request("stepOut", map[string]any{"threadId": threadID})
+	c.stopped("step", "script", 5)
+
+	c.request("continue", map[string]any{"threadId": threadID})
+	c.stopped("breakpoint", "add", 2)
+	if locals := c.locals(); locals["a"] != "3" || locals["b"] != "4" {
+		t.Fatalf("got locals %v", locals)
+	}
+
+	c.request("continue", map[string]any{"threadId": threadID})
+	if code := c.event("exited")["exitCode"]; code != 0.0 {
+		t.Errorf("exited with %v", code)
+	}
+	c.event("terminated")
+	if want := "3\n7\n"; c.output.String() != want {
+		t.Errorf("got output %q, want %q", c.output.String(), want)
+	}
+
+	c.request("disconnect", nil)
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,218 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sushil-cmd-r/glox/ast"
+	"github.com/sushil-cmd-r/glox/parser"
+)
+
+const indent = "  "
+
+// Source parses src and returns it in canonical form.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(src)
+	prog, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := Fprint(&buf, prog); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Fprint writes prog to w, one statement per line with blocks indented.
+func Fprint(w io.Writer, prog []ast.Stmt) error {
+	p := &printer{}
+	p.stmts(prog)
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	buf   bytes.Buffer
+	depth int
+}
+
+// stmts prints one statement per line and separates statements spanning
+// several lines, such as functions, from their neighbours with a blank line.
+func (p *printer) stmts(stmts []ast.Stmt) {
+	prevMulti := false
+	for i, stmt := range stmts {
+		sp := &printer{depth: p.depth}
+		sp.stmt(stmt)
+
+		multi := bytes.ContainsRune(sp.buf.Bytes(), '\n')
+		if i > 0 && (multi || prevMulti) {
+			p.buf.WriteByte('\n')
+		}
+		prevMulti = multi
+
+		p.buf.WriteString(strings.Repeat(indent, p.depth))
+		p.buf.Write(sp.buf.Bytes())
+		p.buf.WriteByte('\n')
+	}
+}
+
+func (p *printer) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		p.expr(stmt.Expression)
+
+	case *ast.LetStmt:
+		p.buf.WriteString("let " + stmt.Name.Name)
+		if _, ok := stmt.Value.(*ast.NilExpr); !ok {
+			p.buf.WriteString(" = ")
+			p.expr(stmt.Value)
+		}
+
+	case *ast.AssignStmt:
+		p.expr(stmt.Name)
+		p.buf.WriteString(" = ")
+		p.expr(stmt.Value)
+
+	case *ast.BlockStmt:
+		p.block(stmt)
+
+	case *ast.PrintStmt:
+		p.buf.WriteString("print ")
+		p.expr(stmt.Expr)
+
+	case *ast.FuncStmt:
+		p.buf.WriteString("function " + stmt.Name.Name)
+		p.funcExpr(stmt.FuncExpr)
+
+	case *ast.ForInStmt:
+		p.buf.WriteString("for " + stmt.Name.Name + " in ")
+		p.expr(stmt.Iterable)
+		p.buf.WriteByte(' ')
+		p.block(stmt.Body)
+
+	case *ast.ImportStmt:
+		p.buf.WriteString("import ")
+		if stmt.Alias {
+			p.buf.WriteString(stmt.Name.Name + " ")
+		}
+		p.buf.WriteString(`"` + stmt.Path + `"`)
+
+	case *ast.ExportStmt:
+		p.buf.WriteString("export ")
+		p.stmt(stmt.Decl)
+
+	case *ast.ThrowStmt:
+		p.buf.WriteString("throw ")
+		p.expr(stmt.Value)
+
+	case *ast.TryStmt:
+		p.buf.WriteString("try ")
+		p.block(stmt.Body)
+		if stmt.Catch != nil {
+			p.buf.WriteString(" catch ")
+			if stmt.CatchName != nil {
+				p.buf.WriteString("(" + stmt.CatchName.Name + ") ")
+			}
+			p.block(stmt.Catch)
+		}
+		if stmt.Finally != nil {
+			p.buf.WriteString(" finally ")
+			p.block(stmt.Finally)
+		}
+
+	case *ast.ReturnStmt:
+		p.buf.WriteString("return")
+		if _, ok := stmt.Value.(*ast.NilExpr); !ok {
+			p.buf.WriteByte(' ')
+			p.expr(stmt.Value)
+		}
+
+	default:
+		panic(fmt.Sprintf("format: unexpected stmt %T", stmt))
+	}
+}
+
+func (p *printer) block(block *ast.BlockStmt) {
+	if len(block.Stmts) == 0 {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	p.buf.WriteString("{\n")
+	p.depth += 1
+	p.stmts(block.Stmts)
+	p.depth -= 1
+	p.buf.WriteString(strings.Repeat(indent, p.depth) + "}")
+}
+
+func (p *printer) funcExpr(fn *ast.FuncExpr) {
+	var params []string
+	for _, param := range fn.Params {
+		params = append(params, param.Name)
+	}
+
+	p.buf.WriteString("(" + strings.Join(params, ", ") + ") ")
+	p.block(fn.Body)
+}
+
+func (p *printer) expr(expr ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.BinaryExpr:
+		p.expr(expr.Left)
+		p.buf.WriteString(" " + expr.Op.String() + " ")
+		p.expr(expr.Right)
+
+	case *ast.UnaryExpr:
+		p.buf.WriteString(expr.Op.String())
+		p.expr(expr.Left)
+
+	case *ast.GroupExpr:
+		p.buf.WriteByte('(')
+		p.expr(expr.Expression)
+		p.buf.WriteByte(')')
+
+	case *ast.NumberLit:
+		p.buf.WriteString(strconv.FormatFloat(expr.Value, 'f', -1, 64))
+
+	case *ast.StringLit:
+		p.buf.WriteString(`"` + expr.Value + `"`)
+
+	case *ast.BoolLit:
+		p.buf.WriteString(strconv.FormatBool(expr.Value))
+
+	case *ast.NilExpr:
+		p.buf.WriteString("nil")
+
+	case *ast.IdentExpr:
+		p.buf.WriteString(expr.Name)
+
+	case *ast.CallExpr:
+		p.expr(expr.Callee)
+		p.buf.WriteByte('(')
+		for i, arg := range expr.Args {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.expr(arg)
+		}
+		p.buf.WriteByte(')')
+
+	case *ast.GetExpr:
+		p.expr(expr.Object)
+		p.buf.WriteString("." + expr.Name.Name)
+
+	case *ast.FuncExpr:
+		p.buf.WriteString("fn ")
+		p.funcExpr(expr)
+
+	default:
+		panic(fmt.Sprintf("format: unexpected expr %T", expr))
+	}
+}
@@ -1,9 +1,15 @@
 package parser
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sushil-cmd-r/glox/token"
+)
 
 type Error struct {
 	Msg string
+	Tok token.Token
 }
 
 func (e Error) Error() string {
@@ -23,8 +29,8 @@ func (e ErrorList) Error() string {
 	return fmt.Sprintf("%s and (%d more errors)", e[0], len(e)-1)
 }
 
-func (e *ErrorList) Add(msg string) {
-	*e = append(*e, Error{Msg: msg})
+func (e *ErrorList) Add(tok token.Token, msg string) {
+	*e = append(*e, Error{Msg: msg, Tok: tok})
 }
 
 func (e ErrorList) Len() int {
@@ -38,3 +44,15 @@ func (e ErrorList) Err() error {
 
 	return e
 }
+
+// Incomplete reports whether err is a syntax error caused by the source
+// ending early, such as an unclosed '{' or '(', so that more input could
+// complete it.
+func Incomplete(err error) bool {
+	var list ErrorList
+	if !errors.As(err, &list) || list.Len() == 0 {
+		return false
+	}
+
+	return list[0].Tok == token.EOF
+}
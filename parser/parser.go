@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/sushil-cmd-r/glox/ast"
 	"github.com/sushil-cmd-r/glox/scanner"
@@ -14,8 +15,9 @@ type Parser struct {
 
 	err *ErrorList
 
-	tok token.Token
-	lit string
+	tok  token.Token
+	lit  string
+	line int
 }
 
 func New(source []byte) *Parser {
@@ -47,26 +49,157 @@ func (p *Parser) parseStmt() ast.Stmt {
 		return p.parsePrintStmt()
 	case token.FUNCTION:
 		return p.parseFuncStmt()
+	case token.RETURN:
+		return p.parseReturnStmt()
+	case token.FOR:
+		return p.parseForInStmt()
+	case token.THROW:
+		return p.parseThrowStmt()
+	case token.TRY:
+		return p.parseTryStmt()
+	case token.IMPORT:
+		return p.parseImportStmt()
+	case token.EXPORT:
+		return p.parseExportStmt()
 	default:
 		return p.parsePriamryStmt()
 	}
 }
 
 func (p *Parser) parseFuncStmt() *ast.FuncStmt {
+	line := p.line
 	p.expect(token.FUNCTION)
 	name := p.parseIdentifier()
 
 	funcExpr := p.parseFuncExpr()
-	return &ast.FuncStmt{Name: name, FuncExpr: funcExpr}
+	return &ast.FuncStmt{Name: name, FuncExpr: funcExpr, Line: line}
+}
+
+func (p *Parser) parseForInStmt() *ast.ForInStmt {
+	line := p.line
+	p.advance()
+	name := p.parseIdentifier()
+	p.expect(token.IN)
+
+	iterable := p.parseExpr(token.PrecLowest)
+	body := p.parseBlock()
+	return &ast.ForInStmt{Name: name, Iterable: iterable, Body: body, Line: line}
+}
+
+func (p *Parser) parseThrowStmt() *ast.ThrowStmt {
+	line := p.line
+	p.advance()
+	expr := p.parseExpr(token.PrecLowest)
+	return &ast.ThrowStmt{Value: expr, Line: line}
+}
+
+func (p *Parser) parseTryStmt() *ast.TryStmt {
+	stmt := &ast.TryStmt{Line: p.line}
+	p.advance()
+	stmt.Body = p.parseBlock()
+
+	if p.tok == token.CATCH {
+		p.advance()
+		if p.tok == token.LPAREN {
+			p.advance()
+			stmt.CatchName = p.parseIdentifier()
+			p.expect(token.RPAREN)
+		}
+		stmt.Catch = p.parseBlock()
+	}
+
+	if p.tok == token.FINALLY {
+		p.advance()
+		stmt.Finally = p.parseBlock()
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.expectError("catch or finally")
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStmt() *ast.ImportStmt {
+	stmt := &ast.ImportStmt{Line: p.line}
+	p.advance()
+
+	if p.tok == token.IDENTIFIER {
+		stmt.Name = p.parseIdentifier()
+		stmt.Alias = true
+	}
+
+	if p.tok != token.STRING {
+		p.expectError("import path")
+		return stmt
+	}
+	stmt.Path = p.parseString().Value
+
+	if !stmt.Alias {
+		name := importName(stmt.Path)
+		if tok, lit := scanner.Init([]byte(name)).Scan(); tok != token.IDENTIFIER || lit != name {
+			p.errors(fmt.Sprintf("import %q needs a name: import name \"%s\"", stmt.Path, stmt.Path))
+		}
+		stmt.Name = &ast.IdentExpr{Name: name}
+	}
+	return stmt
+}
+
+// importName returns the name an import of path binds by default: its last
+// element without the extension.
+func importName(path string) string {
+	name := path[strings.LastIndex(path, "/")+1:]
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func (p *Parser) parseExportStmt() *ast.ExportStmt {
+	line := p.line
+	p.advance()
+
+	switch p.tok {
+	case token.LET:
+		return &ast.ExportStmt{Decl: p.parseLetStmt(), Line: line}
+	case token.FUNCTION:
+		return &ast.ExportStmt{Decl: p.parseFuncStmt(), Line: line}
+	default:
+		p.expectError("let or function")
+		return &ast.ExportStmt{Decl: &ast.ExprStmt{Expression: &ast.NilExpr{}}, Line: line}
+	}
+}
+
+// parseBlock parses a block that must follow, such as the body of a
+// statement.
+func (p *Parser) parseBlock() *ast.BlockStmt {
+	if p.tok != token.LCURLY {
+		p.expectError("'{'")
+		return &ast.BlockStmt{Line: p.line}
+	}
+	return p.parseBlockStmt()
+}
+
+func (p *Parser) parseReturnStmt() *ast.ReturnStmt {
+	line := p.line
+	p.advance()
+	if p.tok == token.SEMI || p.tok == token.RCURLY {
+		return &ast.ReturnStmt{Value: &ast.NilExpr{}, Line: line}
+	}
+
+	expr := p.parseExpr(token.PrecLowest)
+	return &ast.ReturnStmt{Value: expr, Line: line}
 }
 
 func (p *Parser) parsePrintStmt() *ast.PrintStmt {
+	line := p.line
 	p.advance()
 	expr := p.parseExpr(token.PrecLowest)
-	return &ast.PrintStmt{Expr: expr}
+	return &ast.PrintStmt{Expr: expr, Line: line}
 }
 
 func (p *Parser) parseBlockStmt() *ast.BlockStmt {
+	line := p.line
 	p.advance()
 	var stmts []ast.Stmt
 	for p.tok != token.EOF && p.tok != token.RCURLY {
@@ -75,55 +208,36 @@ func (p *Parser) parseBlockStmt() *ast.BlockStmt {
 		stmts = append(stmts, stmt)
 	}
 
+	end := p.line
 	p.expect(token.RCURLY)
-	return &ast.BlockStmt{Stmts: stmts}
+	return &ast.BlockStmt{Stmts: stmts, Line: line, End: end}
 }
 
 func (p *Parser) parseLetStmt() *ast.LetStmt {
+	line := p.line
 	p.advance()
 	name := p.parseIdentifier()
 
 	if p.tok != token.ASSIGN {
-		return &ast.LetStmt{Name: name, Value: &ast.NilExpr{}}
+		return &ast.LetStmt{Name: name, Value: &ast.NilExpr{}, Line: line}
 	}
 	p.advance()
 	expr := p.parseExpr(token.PrecLowest)
 
-	return &ast.LetStmt{Name: name, Value: expr}
+	return &ast.LetStmt{Name: name, Value: expr, Line: line}
 }
 
 func (p *Parser) parsePriamryStmt() ast.Stmt {
+	line := p.line
 	expression := p.parseExpr(token.PrecLowest)
 
 	if p.tok == token.ASSIGN {
 		p.advance()
 		value := p.parseExpr(token.PrecLowest)
-		return &ast.AssignStmt{Name: expression, Value: value}
+		return &ast.AssignStmt{Name: expression, Value: value, Line: line}
 	}
 
-	if p.tok == token.LPAREN {
-		var args []ast.Expr
-		p.advance()
-
-		for p.tok != token.RPAREN && p.tok != token.EOF {
-			arg := p.parseExpr(token.PrecLowest)
-			args = append(args, arg)
-
-			if p.tok != token.COMMA {
-				if p.tok == token.RPAREN {
-					break
-				}
-
-				p.errors("missing , in argument list")
-			}
-			p.advance()
-		}
-
-		p.expect(token.RPAREN)
-		expression = &ast.CallExpr{Callee: expression, Args: args}
-	}
-
-	return &ast.ExprStmt{Expression: expression}
+	return &ast.ExprStmt{Expression: expression, Line: line}
 }
 
 func (p *Parser) parseExpr(prec int) ast.Expr {
@@ -148,14 +262,49 @@ func (p *Parser) parseUnary() ast.Expr {
 		return &ast.UnaryExpr{Op: op, Left: left}
 	}
 
-	return p.parsePrimary()
+	return p.parseCall()
+}
+
+func (p *Parser) parseCall() ast.Expr {
+	expression := p.parsePrimary()
+
+	for p.tok == token.LPAREN || p.tok == token.DOT {
+		if p.tok == token.DOT {
+			p.advance()
+			name := p.parseIdentifier()
+			expression = &ast.GetExpr{Object: expression, Name: name}
+			continue
+		}
+
+		var args []ast.Expr
+		p.advance()
+
+		for p.tok != token.RPAREN && p.tok != token.EOF {
+			arg := p.parseExpr(token.PrecLowest)
+			args = append(args, arg)
+
+			if p.tok != token.COMMA {
+				if p.tok == token.RPAREN {
+					break
+				}
+
+				p.errors("missing , in argument list")
+			}
+			p.advance()
+		}
+
+		p.expect(token.RPAREN)
+		expression = &ast.CallExpr{Callee: expression, Args: args}
+	}
+
+	return expression
 }
 
 func (p *Parser) parseBinary(left ast.Expr) ast.Expr {
 	op := p.tok
 	p.advance()
 
-	right := p.parseExpr(token.PrecLowest)
+	right := p.parseExpr(op.Precedence())
 	return &ast.BinaryExpr{Op: op, Left: left, Right: right}
 }
 
@@ -171,6 +320,13 @@ func (p *Parser) parsePrimary() ast.Expr {
 		return p.parseGroup()
 	case token.FN:
 		return p.parseFuncExpr()
+	case token.NIL:
+		p.advance()
+		return &ast.NilExpr{}
+	case token.TRUE, token.FALSE:
+		tok := p.tok
+		p.advance()
+		return &ast.BoolLit{Value: tok == token.TRUE}
 
 	default:
 		p.expectError("expression")
@@ -265,11 +421,22 @@ func (p *Parser) expectError(msg string) {
 	p.errors(msg)
 }
 
+// maxErrors is the number of errors reported before parsing gives up.
+const maxErrors = 10
+
 func (p *Parser) errors(msg string) {
-	n := p.err.Len()
-	assert(n < 10, "too many errors")
+	switch n := p.err.Len(); {
+	case n < maxErrors:
+		p.err.Add(p.tok, msg)
+
+	case n == maxErrors:
+		p.err.Add(p.tok, "too many errors")
 
-	p.err.Add(msg)
+		// Skip the rest of the source so that parsing stops.
+		for p.tok != token.EOF {
+			p.advance()
+		}
+	}
 }
 
 func (p *Parser) assertTok(expect token.Token) (token.Token, string) {
@@ -288,4 +455,5 @@ func assert(cond bool, msg string) {
 
 func (p *Parser) advance() {
 	p.tok, p.lit = p.sc.Scan()
+	p.line = p.sc.Line()
 }
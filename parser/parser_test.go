@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/ast"
+)
+
+// group renders expr with every binary expression in parentheses.
+func group(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		return fmt.Sprintf("(%s %s %s)", group(e.Left), e.Op, group(e.Right))
+	case *ast.NumberLit:
+		return fmt.Sprint(e.Value)
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
+
+func TestBinaryPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"8 / 4 / 2", "((8 / 4) / 2)"},
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"1 * 2 + 3", "((1 * 2) + 3)"},
+		{"1 - 2 * 3 + 4", "((1 - (2 * 3)) + 4)"},
+		{"1 * 2 - 3 / 4 * 5", "((1 * 2) - ((3 / 4) * 5))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			prog, err := New([]byte("print " + tt.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := group(prog[0].(*ast.PrintStmt).Expr)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTooManyErrors(t *testing.T) {
+	_, err := New([]byte(strings.Repeat(") ", 12))).Parse()
+
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("got %v, want an ErrorList", err)
+	}
+	if n := list.Len(); n != maxErrors+1 {
+		t.Errorf("got %d errors, want %d", n, maxErrors+1)
+	}
+	if last := list[list.Len()-1].Msg; last != "too many errors" {
+		t.Errorf("last error is %q, want too many errors", last)
+	}
+	if Incomplete(err) {
+		t.Error("too many errors reported as incomplete input")
+	}
+}
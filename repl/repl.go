@@ -0,0 +1,139 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sushil-cmd-r/glox/parser"
+	"github.com/sushil-cmd-r/glox/vm"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+const (
+	prompt     = "> "
+	contPrompt = "... "
+)
+
+const help = `commands:
+  :dis    toggle bytecode disassembly
+  :trace  toggle instruction tracing
+  :reset  discard pending input
+  :help   show this message
+  :quit   exit the repl
+`
+
+// Start reads statements from in and runs them against a single VM, so
+// globals persist between lines. Input is buffered until it parses, letting
+// blocks and calls span several lines. Results of expression statements are
+// printed to out.
+func Start(in io.Reader, out io.Writer) {
+	Run(vm.Init(false), in, out)
+}
+
+func Run(machine *vm.VM, in io.Reader, out io.Writer) {
+	r := &repl{machine: machine, out: out}
+	sc := bufio.NewScanner(in)
+	var buf strings.Builder
+
+	for {
+		if buf.Len() == 0 {
+			fmt.Fprint(out, prompt)
+		} else {
+			fmt.Fprint(out, contPrompt)
+		}
+
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := sc.Text()
+
+		if buf.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.command(strings.TrimSpace(line)); quit {
+				return
+			}
+			continue
+		}
+
+		if strings.TrimSpace(line) == ":reset" {
+			buf.Reset()
+			continue
+		}
+
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+
+		res, err := r.eval([]byte(buf.String()))
+		if err != nil && parser.Incomplete(err) {
+			continue
+		}
+		buf.Reset()
+
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+
+		if res.Type() != obj.NilObj {
+			fmt.Fprintln(out, res)
+		}
+	}
+}
+
+type repl struct {
+	machine *vm.VM
+	out     io.Writer
+
+	// dis prints the bytecode of each line before it runs.
+	dis bool
+}
+
+// eval compiles and runs src, disassembling it first if :dis is on.
+func (r *repl) eval(src []byte) (obj.Obj, error) {
+	fn, err := r.machine.CompileEval(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.dis {
+		if err := obj.WriteText(r.out, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.machine.RunEval(fn)
+}
+
+func (r *repl) command(cmd string) bool {
+	switch cmd {
+	case ":quit", ":q":
+		return true
+
+	case ":dis":
+		r.dis = !r.dis
+		fmt.Fprintf(r.out, "disassembly %s\n", onOff(r.dis))
+
+	case ":trace":
+		r.machine.SetDebug(!r.machine.Debug())
+		fmt.Fprintf(r.out, "tracing %s\n", onOff(r.machine.Debug()))
+
+	case ":reset":
+
+	case ":help":
+		fmt.Fprint(r.out, help)
+
+	default:
+		fmt.Fprintf(r.out, "unknown command %s, try :help\n", cmd)
+	}
+
+	return false
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
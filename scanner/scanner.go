@@ -11,6 +11,9 @@ type Scanner struct {
 	ch     byte
 	offset int
 
+	line    int
+	tokLine int
+
 	insertSemi bool
 }
 
@@ -22,6 +25,8 @@ func Init(source []byte) *Scanner {
 		ch:     ' ',
 		offset: 0,
 
+		line: 1,
+
 		insertSemi: false,
 	}
 	s.advance()
@@ -39,8 +44,14 @@ func (s *Scanner) skipWhitespace() {
 	}
 }
 
+// Line returns the line of the token last returned by Scan.
+func (s *Scanner) Line() int {
+	return s.tokLine
+}
+
 func (s *Scanner) Scan() (tok token.Token, lit string) {
 	s.skipWhitespace()
+	s.tokLine = s.line
 	ch := s.ch
 	s.advance()
 
@@ -73,6 +84,8 @@ func (s *Scanner) Scan() (tok token.Token, lit string) {
 		tok, lit = scanToken(token.RCURLY)
 	case ',':
 		tok, lit = scanToken(token.COMMA)
+	case '.':
+		tok, lit = scanToken(token.DOT)
 	case ';':
 		tok, lit = scanToken(token.SEMI)
 
@@ -99,7 +112,8 @@ func (s *Scanner) Scan() (tok token.Token, lit string) {
 
 		} else if isChar(ch) {
 			tok, lit = s.scanIdentifier()
-			if tok == token.IDENTIFIER {
+			switch tok {
+			case token.IDENTIFIER, token.NIL, token.TRUE, token.FALSE, token.RETURN:
 				insertSemi = true
 			}
 
@@ -175,6 +189,10 @@ func (s *Scanner) switch0(t1, t2 token.Token) (token.Token, string) {
 }
 
 func (s *Scanner) advance() {
+	if s.ch == '\n' {
+		s.line += 1
+	}
+
 	if s.atEnd() {
 		s.ch = eof
 		s.offset = len(s.source)
@@ -16,6 +16,7 @@ const (
 	LCURLY // {
 	RCURLY // }
 	COMMA  // ,
+	DOT    // .
 	SEMI   // ;
 	NOT    // !
 
@@ -36,6 +37,17 @@ const (
 	PRINT    // print
 	FUNCTION // function
 	FN       // fn
+	RETURN   // return
+	TRUE     // true
+	FALSE    // false
+	FOR      // for
+	IN       // in
+	THROW    // throw
+	TRY      // try
+	CATCH    // catch
+	FINALLY  // finally
+	IMPORT   // import
+	EXPORT   // export
 	keywordEnd
 )
 
@@ -53,6 +65,7 @@ var tokens = [...]string{
 	LCURLY: "{",
 	RCURLY: "}",
 	COMMA:  ",",
+	DOT:    ".",
 	SEMI:   ";",
 	NOT:    "!",
 
@@ -72,6 +85,17 @@ var tokens = [...]string{
 	PRINT:    "print",
 	FUNCTION: "function",
 	FN:       "fn",
+	RETURN:   "return",
+	TRUE:     "true",
+	FALSE:    "false",
+	FOR:      "for",
+	IN:       "in",
+	THROW:    "throw",
+	TRY:      "try",
+	CATCH:    "catch",
+	FINALLY:  "finally",
+	IMPORT:   "import",
+	EXPORT:   "export",
 }
 
 func (tok Token) String() string {
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+// benchmarkCall defines the functions in src and then calls its function
+// work b.N times, so that compiling src is not measured.
+func benchmarkCall(b *testing.B, src string) {
+	b.Helper()
+
+	machine := Init(false)
+	if err := machine.Execute([]byte(src)); err != nil {
+		b.Fatal(err)
+	}
+	work, ok := machine.GetGlobal("work")
+	if !ok {
+		b.Fatal("work is not defined")
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := machine.Call(work); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// repeat returns a function body made of n copies of stmt.
+func repeat(stmt string, n int) string {
+	return strings.Repeat("  "+stmt+"\n", n)
+}
+
+func BenchmarkGlobalReadWrite(b *testing.B) {
+	benchmarkCall(b, "let total = 0\nlet step = 3\nfunction work() {\n"+repeat("total = total + step", 100)+"}\n")
+}
+
+func BenchmarkGlobalCalls(b *testing.B) {
+	benchmarkCall(b, "function inc(x) {\n  return x + 1\n}\nlet n = 0\nfunction work() {\n"+repeat("n = inc(n)", 100)+"}\n")
+}
+
+// BenchmarkGlobalLateBound reads a global that is defined after the function
+// reading it is compiled.
+func BenchmarkGlobalLateBound(b *testing.B) {
+	benchmarkCall(b, "let sum = 0\nfunction work() {\n"+repeat("sum = sum + later", 100)+"}\nlet later = 1\n")
+}
+
+func BenchmarkArithmeticLocals(b *testing.B) {
+	benchmarkCall(b, "function work() {\n  let a = 1\n  let c = 2\n"+repeat("a = a + c * 2 - 1", 100)+"  a = -a\n}\n")
+}
+
+func BenchmarkArithmeticGlobals(b *testing.B) {
+	benchmarkCall(b, "let a = 1\nlet c = 2\nfunction work() {\n"+repeat("a = a + c * 2 - 1", 100)+"  a = -a\n}\n")
+}
+
+// BenchmarkLiterals assigns booleans and nil, which are pushed from
+// instructions rather than the constant pool.
+func BenchmarkLiterals(b *testing.B) {
+	benchmarkCall(b, "function work() {\n  let t = nil\n"+repeat("t = true", 50)+repeat("t = nil", 50)+"}\n")
+}
+
+// BenchmarkRangeLoop counts with for-in over range. Apart from the call to
+// range, the loop should not allocate.
+func BenchmarkRangeLoop(b *testing.B) {
+	benchmarkCall(b, "function work() {\n  let s = 0\n  for i in range(0, 100, 1) {\n    s = s + i\n  }\n}\n")
+}
+
+func BenchmarkCallLoop(b *testing.B) {
+	benchmarkCall(b, "function inc(x) {\n  return x + 1\n}\nfunction work() {\n  let n = 0\n  for i in range(0, 100, 1) {\n    n = inc(n)\n  }\n}\n")
+}
@@ -0,0 +1,208 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// defineBuiltins sets the functions every script can call as globals of vm.
+func (vm *VM) defineBuiltins() {
+	for _, fn := range []*obj.NativeFn{
+		obj.NewNative("spawn", -1, vm.spawn),
+		obj.NewNative("chan", -1, newChan),
+		obj.NewNative("send", 2, send),
+		obj.NewNative("recv", 1, recv),
+		obj.NewNative("close", 1, closeChan),
+		obj.NewNative("select", -1, selectChan),
+		obj.NewNative("coroutine", 1, vm.coroutine),
+		obj.NewNative("resume", -1, vm.resume),
+		obj.NewNative("yield", -1, vm.yield),
+		obj.NewNative("status", 1, status),
+		obj.NewNative("range", -1, rangeIter),
+	} {
+		vm.SetGlobal(fn.Name(), fn)
+	}
+}
+
+// spawn calls a function with the given arguments on a new VM running on its
+// own goroutine, and returns a channel that receives its result.
+//
+// The new VM starts with a copy of the globals of vm, so assigning a global
+// in either is not seen by the other. Lists and maps are shared rather than
+// copied and must not be modified by one VM while another uses them; values
+// are handed over safely by sending them on a channel. If the function fails,
+// receiving from its channel fails with the same error.
+func (vm *VM) spawn(args []obj.Obj) (obj.Obj, error) {
+	if len(args) == 0 {
+		return nil, errors.New("spawn expects a function")
+	}
+
+	fn := args[0]
+	if t := fn.Type(); t != obj.FuncObj && t != obj.NativeObj {
+		return nil, fmt.Errorf("cannot spawn %s", t)
+	}
+
+	child := vm.fork()
+	result := obj.NewChan(1)
+	go func() {
+		res, err := child.Call(fn, args[1:]...)
+		if err == nil {
+			result.Send(res)
+		}
+		result.CloseWithError(err)
+	}()
+
+	return result, nil
+}
+
+// fork returns a VM with a copy of the globals of vm that shares its output
+// and the modules it has imported. Module globals are not copied: both VMs
+// read and write the same tables, under their locks.
+func (vm *VM) fork() *VM {
+	child := &VM{
+		context: newContext(),
+		globals: vm.globals.Clone(),
+		opts:    vm.opts,
+		out:     vm.out,
+		outMu:   vm.outMu,
+
+		modules:    vm.modules.clone(),
+		importPath: vm.importPath,
+	}
+	child.opts.Debug = false
+
+	// spawn is bound to the VM that calls it.
+	child.defineBuiltins()
+	return child
+}
+
+func newChan(args []obj.Obj) (obj.Obj, error) {
+	switch len(args) {
+	case 0:
+		return obj.NewChan(0), nil
+	case 1:
+		if args[0].Type() != obj.NumberObj {
+			return nil, fmt.Errorf("chan size must be a number, got %s", args[0].Type())
+		}
+		n := obj.AsNum(args[0])
+		if n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid chan size %v", n)
+		}
+		return obj.NewChan(int(n)), nil
+	default:
+		return nil, fmt.Errorf("chan expects at most 1 argument, got %d", len(args))
+	}
+}
+
+func asChan(o obj.Obj) (*obj.Chan, error) {
+	c, ok := o.(*obj.Chan)
+	if !ok {
+		return nil, fmt.Errorf("expected chan, got %s", o.Type())
+	}
+	return c, nil
+}
+
+func send(args []obj.Obj) (obj.Obj, error) {
+	c, err := asChan(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.Send(args[1])
+}
+
+// recv returns the next value on a channel, or nil once it is closed.
+func recv(args []obj.Obj) (obj.Obj, error) {
+	c, err := asChan(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	v, _, err := c.Recv()
+	return v, err
+}
+
+func closeChan(args []obj.Obj) (obj.Obj, error) {
+	c, err := asChan(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.Close()
+}
+
+// SelectResult describes the case that ran in a call to select. Scripts read
+// it through its fields.
+type SelectResult struct {
+	Index int
+	Value obj.Obj
+	OK    bool
+}
+
+func (r *SelectResult) String() string {
+	return fmt.Sprintf("<select %d %s %t>", r.Index, r.Value, r.OK)
+}
+
+// selectChan waits on its arguments, each either a channel to receive from or
+// a [channel, value] list to send, and runs the first case that can proceed.
+// For a send the result holds nil and true.
+func selectChan(args []obj.Obj) (obj.Obj, error) {
+	if len(args) == 0 {
+		return nil, errors.New("select with no cases")
+	}
+
+	cases := make([]obj.SelectCase, len(args))
+	for i, c := range args {
+		if pair, ok := c.(*obj.List); ok {
+			elems := obj.AsList(pair)
+			if len(elems) != 2 {
+				return nil, fmt.Errorf("select case %d: send expects [chan, value]", i)
+			}
+			ch, err := asChan(elems[0])
+			if err != nil {
+				return nil, fmt.Errorf("select case %d: %w", i, err)
+			}
+			cases[i] = obj.SelectCase{Chan: ch, Send: true, Value: elems[1]}
+			continue
+		}
+
+		ch, err := asChan(c)
+		if err != nil {
+			return nil, fmt.Errorf("select case %d: %w", i, err)
+		}
+		cases[i] = obj.SelectCase{Chan: ch}
+	}
+
+	i, v, ok, err := obj.Select(cases)
+	if err != nil {
+		return nil, err
+	}
+	return obj.NewUserData(&SelectResult{Index: i, Value: v, OK: ok}), nil
+}
+
+// rangeIter returns an iterator over range(end), range(start, end) or
+// range(start, end, step).
+func rangeIter(args []obj.Obj) (obj.Obj, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, fmt.Errorf("range expects 1 to 3 arguments, got %d", len(args))
+	}
+
+	nums := make([]float64, len(args))
+	for i, a := range args {
+		if a.Type() != obj.NumberObj {
+			return nil, fmt.Errorf("range argument %d must be a number, got %s", i+1, a.Type())
+		}
+		nums[i] = obj.AsNum(a)
+	}
+
+	start, end, step := 0.0, nums[0], 1.0
+	if len(nums) > 1 {
+		start, end = nums[0], nums[1]
+	}
+	if len(nums) > 2 {
+		step = nums[2]
+	}
+
+	return obj.Range(start, end, step)
+}
@@ -0,0 +1,163 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		globals map[string]obj.Obj
+		want    string
+		err     string
+	}{
+		{
+			name: "spawn result",
+			src:  "print recv(spawn(fn (a, b) { return a + b; }, 2, 3))\n",
+			want: "5\n",
+		},
+		{
+			name: "spawn workers",
+			src: `let results = chan(3)
+function square(n) {
+  send(results, n * n)
+}
+spawn(square, 1)
+spawn(square, 2)
+spawn(square, 3)
+print recv(results) + recv(results) + recv(results)
+`,
+			want: "14\n",
+		},
+		{
+			name: "spawn copies globals",
+			src: `let g = 1
+recv(spawn(fn () { g = 2; }))
+print g
+`,
+			want: "1\n",
+		},
+		{
+			name: "buffered chan",
+			src: `let c = chan(2)
+send(c, 1)
+send(c, 2)
+close(c)
+print recv(c)
+print recv(c)
+print recv(c)
+`,
+			want: "1\n2\n<nil>\n",
+		},
+		{
+			name: "unbuffered chan",
+			src: `let c = chan()
+spawn(fn () {
+  send(c, 0)
+  send(c, 1)
+  send(c, 2)
+  close(c)
+})
+print recv(c)
+print recv(c)
+print recv(c)
+print recv(c)
+`,
+			want: "0\n1\n2\n<nil>\n",
+		},
+		{
+			name: "select receive",
+			src: `let never = chan()
+let c = chan()
+spawn(fn () { send(c, "x"); })
+let s = select(never, c)
+print s.Index
+print s.Value
+print s.OK
+`,
+			want: "1\nx\ntrue\n",
+		},
+		{
+			name: "select send",
+			src: `let s = select(pair)
+print s.Index
+print recv(c)
+`,
+			globals: func() map[string]obj.Obj {
+				c := obj.NewChan(1)
+				return map[string]obj.Obj{"c": c, "pair": obj.NewList([]obj.Obj{c, obj.NewNumber(7)})}
+			}(),
+			want: "0\n7\n",
+		},
+		{
+			name: "select closed",
+			src: `let c = chan()
+close(c)
+let s = select(c)
+print s.OK
+`,
+			want: "false\n",
+		},
+		{
+			name: "spawned error",
+			src:  "recv(spawn(fn () { return nil + 1; }))\n",
+			err:  "invalid operation",
+		},
+		{
+			name: "spawned throw caught",
+			src: `try {
+  recv(spawn(fn () { throw "boom"; }))
+} catch (e) {
+  print e
+}
+`,
+			want: "error: boom\n",
+		},
+		{
+			name: "spawned throw",
+			src:  "recv(spawn(fn () { throw \"boom\"; }))\n",
+			err:  "boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			machine := Init(false)
+			machine.SetOutput(&out)
+			for name, v := range tt.globals {
+				machine.SetGlobal(name, v)
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- machine.ExecuteFile("concurrency.glox", []byte(tt.src))
+			}()
+
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("script did not finish")
+			}
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// ChromeTrace records a span for every function call, in the Chrome Trace
+// Event Format understood by Perfetto and chrome://tracing. Calls made by a
+// coroutine go on a track of their own, as its frames stay open while it is
+// suspended.
+type ChromeTrace struct {
+	events []traceEvent
+	start  time.Time
+
+	// tracks holds the calls that have not returned yet on the main track,
+	// keyed by nil, and on that of each coroutine.
+	tracks map[*Fiber]*traceTrack
+}
+
+type traceTrack struct {
+	tid  int
+	open []obj.Obj
+}
+
+type traceEvent struct {
+	Name  string         `json:"name"`
+	Cat   string         `json:"cat,omitempty"`
+	Phase string         `json:"ph"`
+	Time  float64        `json:"ts"`
+	Pid   int            `json:"pid"`
+	Tid   int            `json:"tid"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+func NewChromeTrace() *ChromeTrace {
+	return &ChromeTrace{start: time.Now(), tracks: map[*Fiber]*traceTrack{nil: {tid: 1}}}
+}
+
+// SetChromeTrace records calls made by vm in t, using the call and return
+// hooks. A nil t removes the hooks.
+func (vm *VM) SetChromeTrace(t *ChromeTrace) {
+	if t == nil {
+		vm.OnCall(nil)
+		vm.OnReturn(nil)
+		return
+	}
+
+	vm.OnCall(func(callee obj.Obj, args []obj.Value) {
+		t.call(t.track(vm.fiber), callee, args)
+	})
+	vm.OnReturn(func(callee obj.Obj, _ obj.Value) {
+		t.ret(t.track(vm.fiber), callee)
+	})
+}
+
+// track returns the track of fiber, or the main one if fiber is nil, adding
+// it if needed.
+func (t *ChromeTrace) track(fiber *Fiber) *traceTrack {
+	if tr, ok := t.tracks[fiber]; ok {
+		return tr
+	}
+
+	tr := &traceTrack{tid: len(t.tracks) + 1}
+	t.tracks[fiber] = tr
+	t.events = append(t.events, traceEvent{
+		Name:  "thread_name",
+		Phase: "M",
+		Pid:   1,
+		Tid:   tr.tid,
+		Args:  map[string]any{"name": fmt.Sprintf("coroutine %d", tr.tid-1)},
+	})
+	return tr
+}
+
+func (t *ChromeTrace) call(tr *traceTrack, callee obj.Obj, args []obj.Value) {
+	name := functionName(callee)
+	ev := traceEvent{Name: name, Phase: "B", Time: t.now(), Pid: 1, Tid: tr.tid}
+
+	switch fn := callee.(type) {
+	case *obj.Function:
+		ev.Cat = "function"
+		ev.Args = map[string]any{"line": firstLine(fn), "args": len(args)}
+		if fn.File() != "" {
+			ev.Args["file"] = fn.File()
+		}
+	case *obj.NativeFn:
+		ev.Cat = "native"
+		ev.Args = map[string]any{"args": len(args)}
+	}
+
+	t.events = append(t.events, ev)
+	tr.open = append(tr.open, callee)
+}
+
+// ret ends the innermost open call to callee on tr, and any calls made from
+// it that an error left open.
+func (t *ChromeTrace) ret(tr *traceTrack, callee obj.Obj) {
+	i := len(tr.open) - 1
+	for i >= 0 && tr.open[i] != callee {
+		i--
+	}
+	if i < 0 {
+		return
+	}
+
+	now := t.now()
+	for len(tr.open) > i {
+		name := functionName(tr.open[len(tr.open)-1])
+		tr.open = tr.open[:len(tr.open)-1]
+		t.events = append(t.events, traceEvent{Name: name, Phase: "E", Time: now, Pid: 1, Tid: tr.tid})
+	}
+}
+
+// now returns the time since the trace started in microseconds.
+func (t *ChromeTrace) now() float64 {
+	return float64(time.Since(t.start).Nanoseconds()) / 1e3
+}
+
+// WriteJSON writes the trace as a JSON object. Calls that never returned,
+// because of a runtime error, end at the time of writing.
+func (t *ChromeTrace) WriteJSON(w io.Writer) error {
+	events := slices.Clip(t.events)
+	now := t.now()
+	for _, tr := range t.tracks {
+		for i := len(tr.open) - 1; i >= 0; i-- {
+			events = append(events, traceEvent{Name: functionName(tr.open[i]), Phase: "E", Time: now, Pid: 1, Tid: tr.tid})
+		}
+	}
+
+	return json.NewEncoder(w).Encode(map[string]any{
+		"traceEvents":     events,
+		"displayTimeUnit": "ns",
+	})
+}
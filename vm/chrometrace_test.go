@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestChromeTraceSpans checks that every span ends on the track it began on,
+// in the reverse order of beginning.
+func TestChromeTraceSpans(t *testing.T) {
+	src := `function fails() {
+  try { recv(1); } catch (e) {}
+}
+function gen() {
+  yield(1)
+  yield(2)
+}
+let co = coroutine(gen)
+function outer() {
+  fails()
+  resume(co)
+  resume(co)
+}
+outer()
+`
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+	trace := NewChromeTrace()
+	machine.SetChromeTrace(trace)
+	if err := machine.ExecuteFile("trace.glox", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := trace.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	open := make(map[int][]string)
+	for _, ev := range doc.TraceEvents {
+		switch ev.Phase {
+		case "B":
+			open[ev.Tid] = append(open[ev.Tid], ev.Name)
+		case "E":
+			stack := open[ev.Tid]
+			if len(stack) == 0 || stack[len(stack)-1] != ev.Name {
+				t.Fatalf("tid %d: %s ends, open calls are %v", ev.Tid, ev.Name, stack)
+			}
+			open[ev.Tid] = stack[:len(stack)-1]
+		}
+	}
+	if len(open) < 2 {
+		t.Errorf("the coroutine has no track of its own: %v", open)
+	}
+	for tid, stack := range open {
+		if len(stack) != 0 {
+			t.Errorf("tid %d: calls %v never end", tid, stack)
+		}
+	}
+}
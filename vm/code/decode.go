@@ -0,0 +1,124 @@
+package code
+
+import (
+	"fmt"
+	"math"
+)
+
+// Instruction is a decoded instruction. Wide is set when the instruction was
+// prefixed with OpWide, in which case Offset points at the prefix.
+type Instruction struct {
+	Offset  int
+	Op      Opcode
+	Operand int
+	Wide    bool
+}
+
+// Width returns the number of bytes the instruction takes in encoded form.
+func (inst Instruction) Width() int {
+	n := 1 + OperandWidth(inst.Op)
+	if inst.Wide {
+		n += 2
+	}
+	return n
+}
+
+// Target returns the offset a jump instruction transfers control to.
+func (inst Instruction) Target() int {
+	end := inst.Offset + inst.Width()
+	if inst.Op == OpLoop {
+		return end - inst.Operand
+	}
+	return end + inst.Operand
+}
+
+// Decode splits bytecode into instructions. It fails on unknown opcodes and
+// on instructions cut short by the end of the code.
+func Decode(bytecode []byte) ([]Instruction, error) {
+	var insts []Instruction
+	for i := 0; i < len(bytecode); {
+		inst := Instruction{Offset: i, Op: bytecode[i]}
+		i += 1
+
+		if inst.Op == OpWide {
+			if i == len(bytecode) {
+				return nil, fmt.Errorf("offset %d: OpWide at end of code", inst.Offset)
+			}
+
+			inst.Wide = true
+			inst.Op = bytecode[i]
+			i += 1
+
+			if !IsIndex(inst.Op) {
+				return nil, fmt.Errorf("offset %d: OpWide before %s", inst.Offset, Name(inst.Op))
+			}
+		}
+
+		if int(inst.Op) >= len(Opcodes) {
+			return nil, fmt.Errorf("offset %d: unknown opcode %d", inst.Offset, inst.Op)
+		}
+
+		width := OperandWidth(inst.Op)
+		if inst.Wide {
+			width += 1
+		}
+		if i+width > len(bytecode) {
+			return nil, fmt.Errorf("offset %d: truncated %s", inst.Offset, Name(inst.Op))
+		}
+
+		for j := 0; j < width; j++ {
+			inst.Operand = inst.Operand<<8 | int(bytecode[i])
+			i += 1
+		}
+
+		insts = append(insts, inst)
+	}
+
+	return insts, nil
+}
+
+// Name returns the name of op, or a placeholder for unknown opcodes.
+func Name(op Opcode) string {
+	if int(op) < len(Opcodes) {
+		return Opcodes[op]
+	}
+	return fmt.Sprintf("Op(%d)", op)
+}
+
+// Append encodes an instruction onto bytecode, prefixing it with OpWide when
+// an index operand does not fit in a byte.
+func Append(bytecode []byte, op Opcode, operand int) ([]byte, error) {
+	switch {
+	case OperandWidth(op) == 0:
+		return append(bytecode, op), nil
+
+	case OperandWidth(op) == 2 && operand >= 0 && operand <= math.MaxUint16:
+		return append(bytecode, op, byte(operand>>8), byte(operand)), nil
+
+	case OperandWidth(op) == 1 && operand >= 0 && operand <= math.MaxUint8:
+		return append(bytecode, op, byte(operand)), nil
+
+	case IsIndex(op) && operand >= 0 && operand <= math.MaxUint16:
+		return append(bytecode, OpWide, op, byte(operand>>8), byte(operand)), nil
+
+	default:
+		return nil, fmt.Errorf("operand %d out of range for %s", operand, Name(op))
+	}
+}
+
+// PatchJump sets the operand of the jump instruction at offset in bytecode so
+// that it transfers control to target.
+func PatchJump(bytecode []byte, offset, target int) error {
+	op := bytecode[offset]
+	distance := target - (offset + 1 + OperandWidth(op))
+	if op == OpLoop {
+		distance = -distance
+	}
+
+	if distance < 0 || distance > math.MaxUint16 {
+		return fmt.Errorf("offset %d: %s to %d out of range", offset, Name(op), target)
+	}
+
+	bytecode[offset+1], bytecode[offset+2] = byte(distance>>8), byte(distance)
+	return nil
+}
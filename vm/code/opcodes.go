@@ -11,8 +11,12 @@ const (
 	OpDiv
 	OpNegate
 	OpNot
+	OpEqual
 	OpNil
+	OpTrue
+	OpFalse
 	OpPop
+	OpPopN
 	OpPrint
 	OpCall
 	OpDefineGlobal
@@ -20,6 +24,16 @@ const (
 	OpGetGlobal
 	OpGetLocal
 	OpSetLocal
+	OpTeeLocal
+	OpGetProperty
+	OpSetProperty
+	OpWide
+	OpIter
+	OpIterNext
+	OpLoop
+	OpJump
+	OpThrow
+	OpImport
 )
 
 var Opcodes = [...]string{
@@ -31,8 +45,12 @@ var Opcodes = [...]string{
 	OpDiv:          "OpDiv",
 	OpNegate:       "OpNegate",
 	OpNot:          "OpNot",
+	OpEqual:        "OpEqual",
 	OpNil:          "OpNil",
+	OpTrue:         "OpTrue",
+	OpFalse:        "OpFalse",
 	OpPop:          "OpPop",
+	OpPopN:         "OpPopN",
 	OpPrint:        "OpPrint",
 	OpCall:         "OpCall",
 	OpDefineGlobal: "OpDefineGlobal",
@@ -40,4 +58,72 @@ var Opcodes = [...]string{
 	OpGetGlobal:    "OpGetGlobal",
 	OpGetLocal:     "OpGetLocal",
 	OpSetLocal:     "OpSetLocal",
+	OpTeeLocal:     "OpTeeLocal",
+	OpGetProperty:  "OpGetProperty",
+	OpSetProperty:  "OpSetProperty",
+	OpWide:         "OpWide",
+	OpIter:         "OpIter",
+	OpIterNext:     "OpIterNext",
+	OpLoop:         "OpLoop",
+	OpJump:         "OpJump",
+	OpThrow:        "OpThrow",
+	OpImport:       "OpImport",
+}
+
+// OperandWidth returns the number of operand bytes following op, not counting
+// the extra byte an OpWide prefix adds.
+func OperandWidth(op Opcode) int {
+	switch op {
+	case OpConstant, OpDefineGlobal, OpSetGlobal, OpGetGlobal, OpGetProperty, OpSetProperty,
+		OpGetLocal, OpSetLocal, OpTeeLocal, OpCall, OpPopN, OpImport:
+		return 1
+	case OpIterNext, OpLoop, OpJump:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// IsIndex reports whether the operand of op indexes the constant pool or the
+// globals table, and so may be widened by OpWide.
+func IsIndex(op Opcode) bool {
+	switch op {
+	case OpConstant, OpDefineGlobal, OpSetGlobal, OpGetGlobal, OpGetProperty, OpSetProperty, OpImport:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsJump reports whether op transfers control to another offset. Its operand
+// is the distance to the target from the end of the instruction, backwards
+// for OpLoop and forwards otherwise.
+func IsJump(op Opcode) bool {
+	return op == OpIterNext || op == OpLoop || op == OpJump
+}
+
+// StackEffect returns how many values op pops from and pushes onto the stack
+// when run with the given operand. OpIterNext pushes the next value only when
+// it does not jump.
+func StackEffect(op Opcode, operand int) (pop, push int) {
+	switch op {
+	case OpConstant, OpNil, OpTrue, OpFalse, OpGetGlobal, OpGetLocal, OpImport:
+		return 0, 1
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual:
+		return 2, 1
+	case OpIterNext:
+		return 0, 1
+	case OpNegate, OpNot, OpGetProperty, OpTeeLocal, OpIter:
+		return 1, 1
+	case OpReturn, OpPop, OpPrint, OpDefineGlobal, OpSetGlobal, OpSetLocal, OpThrow:
+		return 1, 0
+	case OpPopN:
+		return operand, 0
+	case OpSetProperty:
+		return 2, 0
+	case OpCall:
+		return operand + 1, 1
+	default:
+		return 0, 0
+	}
 }
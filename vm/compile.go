@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"slices"
+	"sync/atomic"
 
 	"github.com/sushil-cmd-r/glox/ast"
 	"github.com/sushil-cmd-r/glox/token"
@@ -14,36 +16,67 @@ import (
 type Compiler struct {
 	code      []byte
 	constants []obj.Obj
+	lines     obj.LineTable
+	line      int
+
+	// numbers and strs map literal values to their index in constants so
+	// repeated names and literals share one entry.
+	numbers map[uint64]int
+	strs    map[string]int
+
+	globals *obj.Globals
 
 	locals [math.MaxUint8]Local
 
+	// debugLocals records where each local is live for debuggers.
+	debugLocals []obj.LocalInfo
+
 	localCount int
 	scopeDepth int
 
-	debug bool
+	// height is the number of values on the stack as code is emitted. It is
+	// reset to the locals at each statement, and deep records the first line
+	// where it passed obj.MaxStack.
+	height int
+	deep   int
+
+	// tries holds the try statements enclosing the code being compiled,
+	// innermost last, and handlers the handler table built from them.
+	tries    []*tryState
+	handlers []obj.Handler
+
+	// exports lists the globals declared with export.
+	exports []string
+
+	opts Options
 }
 
-func initCompiler() *Compiler {
+func initCompiler(globals *obj.Globals) *Compiler {
 	c := &Compiler{
 		code:      make([]byte, 0),
 		constants: make([]obj.Obj, 0),
+		numbers:   make(map[uint64]int),
+		strs:      make(map[string]int),
+		globals:   globals,
 
 		localCount: 0,
 		scopeDepth: 0,
 	}
 
-	l := Local{depth: 0, name: ""}
+	l := Local{depth: 0, name: "", debug: -1}
 	c.locals[c.localCount] = l
 	c.localCount += 1
 
 	return c
 }
 
-var annonymousCnt = 0
+var annonymousCnt atomic.Int64
 
-func Compile(prog *ast.FuncExpr, fname string, debug bool) (*obj.Function, error) {
-	c := initCompiler()
-	c.debug = debug
+// compileFunction compiles prog into a function named fname. Global names are
+// resolved to slots in globals, which the VM running the function must use.
+func compileFunction(prog *ast.FuncExpr, fname string, globals *obj.Globals, opts Options) (*obj.Function, error) {
+	c := initCompiler(globals)
+	c.opts = opts
 
 	if fname != InitFunc {
 		c.beginScope()
@@ -66,20 +99,40 @@ func Compile(prog *ast.FuncExpr, fname string, debug bool) (*obj.Function, error
 		}
 	}
 
+	if prog.Body.End > 0 {
+		c.line = prog.Body.End
+	}
+	c.emitInst(code.OpNil, nil)
 	c.emitInst(code.OpReturn, nil)
+	if err := c.checkHeight(); err != nil {
+		return nil, err
+	}
 	if fname != InitFunc {
 		c.endScope()
 	}
 
-	fn := obj.NewFunction(fname, len(prog.Params), c.code, c.constants)
-
-	if debug {
-		fn.PrintCode()
+	if !opts.NoPeephole {
+		if err := c.peephole(); err != nil {
+			return nil, err
+		}
 	}
+
+	fn := obj.NewFunction(fname, len(prog.Params), c.code, c.constants, c.lines, c.globals)
+	fn.SetLocals(c.debugLocals)
+	fn.SetHandlers(c.handlers)
+	fn.SetExports(c.exports)
 	return fn, nil
 }
 
 func (c *Compiler) compileStmt(stmt ast.Stmt) error {
+	if err := c.checkHeight(); err != nil {
+		return err
+	}
+	if line := stmt.Pos(); line > 0 {
+		c.line = line
+	}
+	c.height = c.localCount
+
 	switch stmt := stmt.(type) {
 	case *ast.ExprStmt:
 		return c.compileExprStmt(stmt)
@@ -99,6 +152,24 @@ func (c *Compiler) compileStmt(stmt ast.Stmt) error {
 	case *ast.FuncStmt:
 		return c.compileFuncStmt(stmt)
 
+	case *ast.ReturnStmt:
+		return c.compileReturnStmt(stmt)
+
+	case *ast.ForInStmt:
+		return c.compileForInStmt(stmt)
+
+	case *ast.ThrowStmt:
+		return c.compileThrowStmt(stmt)
+
+	case *ast.TryStmt:
+		return c.compileTryStmt(stmt)
+
+	case *ast.ImportStmt:
+		return c.compileImportStmt(stmt)
+
+	case *ast.ExportStmt:
+		return c.compileExportStmt(stmt)
+
 	default:
 		panic("unimplemented stmt")
 	}
@@ -111,7 +182,7 @@ func (c *Compiler) compileFuncStmt(stmt *ast.FuncStmt) error {
 	}
 
 	ident := stmt.Name
-	fn, err := Compile(stmt.FuncExpr, ident.Name, c.debug)
+	fn, err := compileFunction(stmt.FuncExpr, ident.Name, c.globals, c.opts)
 	if err != nil {
 		return err
 	}
@@ -121,6 +192,288 @@ func (c *Compiler) compileFuncStmt(stmt *ast.FuncStmt) error {
 	return nil
 }
 
+var ErrTopLevelReturn = errors.New("return outside function")
+
+// topLevelReturn returns the first return statement in stmts that is not in
+// a function, or nil if there is none.
+func topLevelReturn(stmts []ast.Stmt) *ast.ReturnStmt {
+	for _, stmt := range stmts {
+		var ret *ast.ReturnStmt
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStmt:
+			ret = stmt
+		case *ast.BlockStmt:
+			ret = topLevelReturn(stmt.Stmts)
+		case *ast.ForInStmt:
+			ret = topLevelReturn(stmt.Body.Stmts)
+		case *ast.TryStmt:
+			ret = topLevelReturn(stmt.Body.Stmts)
+			if ret == nil && stmt.Catch != nil {
+				ret = topLevelReturn(stmt.Catch.Stmts)
+			}
+			if ret == nil && stmt.Finally != nil {
+				ret = topLevelReturn(stmt.Finally.Stmts)
+			}
+		}
+
+		if ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// compileReturnStmt runs the finally blocks of the enclosing try statements
+// before returning. The value is kept in a hidden local meanwhile, and each
+// finally block is compiled outside the handlers of the statements it leaves.
+func (c *Compiler) compileReturnStmt(stmt *ast.ReturnStmt) error {
+	if err := c.compileExpr(stmt.Value); err != nil {
+		return err
+	}
+
+	if !c.inFinally() {
+		c.emitInst(code.OpReturn, nil)
+		return nil
+	}
+
+	c.beginScope()
+	if err := c.declareVariable("return"); err != nil {
+		return err
+	}
+	c.defineVariable(0)
+	slot := c.localCount - 1
+
+	tries := c.tries
+	for i := len(tries) - 1; i >= 0; i-- {
+		tries[i].close(len(c.code))
+		if tries[i].finally == nil {
+			continue
+		}
+
+		c.tries = tries[:i]
+		err := c.compileBlockStmt(tries[i].finally)
+		c.tries = tries
+		if err != nil {
+			return err
+		}
+	}
+
+	c.line = stmt.Line
+	c.emitInsts(code.OpGetLocal, byte(slot))
+	c.emitInst(code.OpReturn, nil)
+	for _, t := range tries {
+		t.open(len(c.code))
+	}
+
+	c.dropScope()
+	return nil
+}
+
+func (c *Compiler) inFinally() bool {
+	for _, t := range c.tries {
+		if t.finally != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compiler) compileThrowStmt(stmt *ast.ThrowStmt) error {
+	if err := c.compileExpr(stmt.Value); err != nil {
+		return err
+	}
+
+	c.emitInst(code.OpThrow, nil)
+	return nil
+}
+
+// tryState tracks the code covered by one handler of a try statement. The
+// code is split into segments where finally blocks are inlined on the way
+// out, so that errors they throw go to the enclosing handlers instead.
+type tryState struct {
+	finally  *ast.BlockStmt
+	depth    int
+	segments [][2]int
+
+	// start is the offset of the open segment, or -1 if there is none.
+	start int
+}
+
+func (t *tryState) open(offset int) {
+	if t.start == -1 {
+		t.start = offset
+	}
+}
+
+func (t *tryState) close(offset int) {
+	if t.start != -1 && t.start < offset {
+		t.segments = append(t.segments, [2]int{t.start, offset})
+	}
+	t.start = -1
+}
+
+func (c *Compiler) beginTry(finally *ast.BlockStmt) *tryState {
+	t := &tryState{finally: finally, depth: c.localCount, start: len(c.code)}
+	c.tries = append(c.tries, t)
+	return t
+}
+
+func (c *Compiler) endTry(t *tryState) {
+	t.close(len(c.code))
+	c.tries = c.tries[:len(c.tries)-1]
+}
+
+// addHandlers sends errors from the segments of t to target. Nested
+// statements end first, so their handlers come before those of t.
+func (c *Compiler) addHandlers(t *tryState, target int) {
+	for _, s := range t.segments {
+		c.handlers = append(c.handlers, obj.Handler{Start: s[0], End: s[1], Target: target, Depth: t.depth})
+	}
+}
+
+// compileTryStmt lays out a try statement as
+//
+//	    <body>
+//	    <finally>
+//	    OpJump end
+//	catch:              ; errors from the body
+//	    <catch>
+//	    <finally>
+//	    OpJump end
+//	rethrow:            ; errors from the body or catch
+//	    <finally>
+//	    OpGetLocal error
+//	    OpThrow
+//	end:
+//
+// A handler starts with the error on the stack above the locals live at the
+// try, which becomes the catch variable or the error to rethrow.
+func (c *Compiler) compileTryStmt(stmt *ast.TryStmt) error {
+	var exits []int
+
+	// exit leaves the statement normally, through the finally block.
+	exit := func() error {
+		if stmt.Finally != nil {
+			if err := c.compileBlockStmt(stmt.Finally); err != nil {
+				return err
+			}
+		}
+		c.line = stmt.Line
+		exits = append(exits, c.emitJump(code.OpJump))
+		return nil
+	}
+
+	// bind defines the error pushed by a handler as a local named name.
+	bind := func(name string) (int, error) {
+		c.beginScope()
+		if err := c.declareVariable(name); err != nil {
+			return 0, err
+		}
+		c.defineVariable(0)
+		return c.localCount - 1, nil
+	}
+
+	body := c.beginTry(stmt.Finally)
+	if err := c.compileBlockStmt(stmt.Body); err != nil {
+		return err
+	}
+	c.endTry(body)
+	if err := exit(); err != nil {
+		return err
+	}
+
+	rethrow := body
+	if stmt.Catch != nil {
+		c.addHandlers(body, len(c.code))
+		if stmt.Finally == nil {
+			rethrow = nil
+		} else {
+			rethrow = c.beginTry(stmt.Finally)
+		}
+
+		// The name cannot clash with a variable as it is a keyword.
+		name := "catch"
+		if stmt.CatchName != nil {
+			name = stmt.CatchName.Name
+		}
+		if _, err := bind(name); err != nil {
+			return err
+		}
+		if err := c.compileBlockStmt(stmt.Catch); err != nil {
+			return err
+		}
+		c.endScope()
+
+		if rethrow == nil {
+			return c.patchExits(exits)
+		}
+		c.endTry(rethrow)
+		if err := exit(); err != nil {
+			return err
+		}
+	}
+
+	c.addHandlers(rethrow, len(c.code))
+	slot, err := bind("finally")
+	if err != nil {
+		return err
+	}
+	if err := c.compileBlockStmt(stmt.Finally); err != nil {
+		return err
+	}
+	c.line = stmt.Line
+	c.emitInsts(code.OpGetLocal, byte(slot))
+	c.emitInst(code.OpThrow, nil)
+	c.dropScope()
+
+	return c.patchExits(exits)
+}
+
+func (c *Compiler) patchExits(exits []int) error {
+	for _, offset := range exits {
+		if err := c.patchJump(offset, len(c.code)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileImportStmt(stmt *ast.ImportStmt) error {
+	i, err := c.registerDeclaration(stmt.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := c.emitInst(code.OpImport, obj.NewStr(stmt.Path)); err != nil {
+		return err
+	}
+
+	return c.defineVariable(i)
+}
+
+var ErrNestedExport = errors.New("export is only allowed at the top level of a script")
+
+func (c *Compiler) compileExportStmt(stmt *ast.ExportStmt) error {
+	if c.scopeDepth > 0 {
+		return ErrNestedExport
+	}
+
+	var name string
+	switch decl := stmt.Decl.(type) {
+	case *ast.LetStmt:
+		name = decl.Name.Name
+	case *ast.FuncStmt:
+		name = decl.Name.Name
+	default:
+		return fmt.Errorf("cannot export %T", stmt.Decl)
+	}
+
+	if !slices.Contains(c.exports, name) {
+		c.exports = append(c.exports, name)
+	}
+	return c.compileStmt(stmt.Decl)
+}
+
 func (c *Compiler) compilePrintStmt(stmt *ast.PrintStmt) error {
 	if err := c.compileExpr(stmt.Expr); err != nil {
 		return err
@@ -143,6 +496,75 @@ func (c *Compiler) compileBlockStmt(stmt *ast.BlockStmt) error {
 	return nil
 }
 
+// compileForInStmt keeps the iterator in a hidden local for the whole loop.
+// Each iteration binds the next value to the loop variable in a scope of its
+// own, which ends before jumping back:
+//
+//	    <iterable>
+//	    OpIter
+//	loop:
+//	    OpIterNext exit
+//	    <body>
+//	    OpPop
+//	    OpLoop loop
+//	exit:
+//	    OpPop
+func (c *Compiler) compileForInStmt(stmt *ast.ForInStmt) error {
+	c.beginScope()
+	if err := c.compileExpr(stmt.Iterable); err != nil {
+		return err
+	}
+	c.emitInst(code.OpIter, nil)
+
+	// The name cannot clash with a variable as it is a keyword.
+	if err := c.declareVariable("for"); err != nil {
+		return err
+	}
+
+	loop := len(c.code)
+	exit := c.emitJump(code.OpIterNext)
+
+	c.beginScope()
+	if err := c.declareVariable(stmt.Name.Name); err != nil {
+		return err
+	}
+	c.defineVariable(0)
+	if err := c.compileBlockStmt(stmt.Body); err != nil {
+		return err
+	}
+
+	// Going round the loop again is attributed to the line of the for.
+	c.line = stmt.Line
+	c.endScope()
+
+	if err := c.patchJump(c.emitJump(code.OpLoop), loop); err != nil {
+		return err
+	}
+	if err := c.patchJump(exit, len(c.code)); err != nil {
+		return err
+	}
+
+	c.endScope()
+	return nil
+}
+
+// emitJump emits a jump instruction whose target is set later by patchJump,
+// and returns its offset.
+func (c *Compiler) emitJump(op code.Opcode) int {
+	offset := len(c.code)
+	c.emit(op, 0, 0)
+	return offset
+}
+
+var ErrLoopTooLarge = errors.New("loop body too large")
+
+func (c *Compiler) patchJump(offset, target int) error {
+	if err := code.PatchJump(c.code, offset, target); err != nil {
+		return ErrLoopTooLarge
+	}
+	return nil
+}
+
 func (c *Compiler) beginScope() {
 	c.scopeDepth += 1
 }
@@ -153,10 +575,32 @@ func (c *Compiler) endScope() {
 	for i := c.localCount - 1; i >= 0 && c.locals[i].depth > c.scopeDepth; i-- {
 		c.emitInst(code.OpPop, nil)
 		c.localCount -= 1
+
+		if d := c.locals[i].debug; d >= 0 {
+			c.debugLocals[d].End = len(c.code)
+		}
+	}
+}
+
+// dropScope ends a scope after code that does not fall through, so its
+// locals are forgotten without emitting pops.
+func (c *Compiler) dropScope() {
+	c.scopeDepth -= 1
+
+	for i := c.localCount - 1; i >= 0 && c.locals[i].depth > c.scopeDepth; i-- {
+		c.localCount -= 1
+
+		if d := c.locals[i].debug; d >= 0 {
+			c.debugLocals[d].End = len(c.code)
+		}
 	}
 }
 
 func (c *Compiler) compileAssignStmt(stmt *ast.AssignStmt) error {
+	if get, ok := stmt.Name.(*ast.GetExpr); ok {
+		return c.compileSetProperty(get, stmt.Value)
+	}
+
 	if err := c.compileExpr(stmt.Value); err != nil {
 		return err
 	}
@@ -168,12 +612,11 @@ func (c *Compiler) compileAssignStmt(stmt *ast.AssignStmt) error {
 
 	arg := c.resolveLocal(ident.Name)
 	if arg == -1 {
-		name := obj.NewStr(ident.Name)
-		i, err := c.addConstant(name)
+		i, err := c.globalSlot(ident.Name)
 		if err != nil {
 			return err
 		}
-		c.emitInsts(code.OpSetGlobal, i)
+		c.emitIndexInst(code.OpSetGlobal, i)
 	} else {
 		c.emitInsts(code.OpSetLocal, byte(arg))
 	}
@@ -181,6 +624,19 @@ func (c *Compiler) compileAssignStmt(stmt *ast.AssignStmt) error {
 	return nil
 }
 
+func (c *Compiler) compileSetProperty(get *ast.GetExpr, value ast.Expr) error {
+	if err := c.compileExpr(get.Object); err != nil {
+		return err
+	}
+
+	if err := c.compileExpr(value); err != nil {
+		return err
+	}
+
+	name := obj.NewStr(get.Name.Name)
+	return c.emitInst(code.OpSetProperty, name)
+}
+
 func (c *Compiler) compileLetStmt(stmt *ast.LetStmt) error {
 	i, err := c.registerDeclaration(stmt.Name)
 	if err != nil {
@@ -194,7 +650,7 @@ func (c *Compiler) compileLetStmt(stmt *ast.LetStmt) error {
 	return c.defineVariable(i)
 }
 
-func (c *Compiler) registerDeclaration(ident *ast.IdentExpr) (byte, error) {
+func (c *Compiler) registerDeclaration(ident *ast.IdentExpr) (int, error) {
 	if err := c.declareVariable(ident.Name); err != nil {
 		return 0, err
 	}
@@ -203,13 +659,27 @@ func (c *Compiler) registerDeclaration(ident *ast.IdentExpr) (byte, error) {
 		return 0, nil
 	}
 
-	str := obj.NewStr(ident.Name)
-	return c.addConstant(str)
+	return c.globalSlot(ident.Name)
+}
+
+var ErrTooManyGlobals = errors.New("too many globals")
+
+func (c *Compiler) globalSlot(name string) (int, error) {
+	i := c.globals.Slot(name)
+	if i > math.MaxUint16 {
+		return 0, ErrTooManyGlobals
+	}
+
+	return i, nil
 }
 
 type Local struct {
 	name  string
 	depth int
+
+	// debug indexes the local's entry in debugLocals, or is -1 before the
+	// local is defined.
+	debug int
 }
 
 func (c *Compiler) declareVariable(name string) error {
@@ -228,18 +698,26 @@ func (c *Compiler) declareVariable(name string) error {
 		}
 	}
 
-	l := Local{name: name, depth: c.scopeDepth}
+	l := Local{name: name, depth: c.scopeDepth, debug: -1}
 	c.locals[c.localCount] = l
 	c.localCount += 1
 	return nil
 }
 
-func (c *Compiler) defineVariable(i byte) error {
+func (c *Compiler) defineVariable(i int) error {
 	if c.scopeDepth > 0 {
+		slot := c.localCount - 1
+		c.locals[slot].debug = len(c.debugLocals)
+		c.debugLocals = append(c.debugLocals, obj.LocalInfo{
+			Name:  c.locals[slot].name,
+			Slot:  slot,
+			Start: len(c.code),
+			End:   len(c.code),
+		})
 		return nil
 	}
 
-	c.emitInsts(code.OpDefineGlobal, i)
+	c.emitIndexInst(code.OpDefineGlobal, i)
 	return nil
 }
 
@@ -285,6 +763,13 @@ func (c *Compiler) compileBinary(expr *ast.BinaryExpr) error {
 		err = c.emitInst(code.OpMul, nil)
 	case token.SLASH:
 		err = c.emitInst(code.OpDiv, nil)
+	case token.EQL:
+		err = c.emitInst(code.OpEqual, nil)
+	case token.NEQ:
+		c.emitInst(code.OpEqual, nil)
+		err = c.emitInst(code.OpNot, nil)
+	default:
+		err = fmt.Errorf("unsupported operator %s", expr.Op)
 	}
 
 	return err
@@ -311,21 +796,38 @@ func (c *Compiler) compilePrimary(expr ast.Expr) error {
 		num := obj.NewNumber(expr.Value)
 		return c.emitInst(code.OpConstant, num)
 
+	case *ast.StringLit:
+		str := obj.NewStr(expr.Value)
+		return c.emitInst(code.OpConstant, str)
+
 	case *ast.GroupExpr:
 		return c.compileExpr(expr.Expression)
 
 	case *ast.NilExpr:
 		return c.emitInst(code.OpNil, nil)
 
+	case *ast.BoolLit:
+		if expr.Value {
+			return c.emitInst(code.OpTrue, nil)
+		}
+		return c.emitInst(code.OpFalse, nil)
+
 	case *ast.IdentExpr:
 		return c.compileIdent(expr)
 
 	case *ast.CallExpr:
 		return c.compileCallExpr(expr)
 
+	case *ast.GetExpr:
+		if err := c.compileExpr(expr.Object); err != nil {
+			return err
+		}
+		name := obj.NewStr(expr.Name.Name)
+		return c.emitInst(code.OpGetProperty, name)
+
 	case *ast.FuncExpr:
-		fn, err := Compile(expr, fmt.Sprintf("Annonymous:%d", annonymousCnt), c.debug)
-		annonymousCnt += 1
+		name := fmt.Sprintf("Annonymous:%d", annonymousCnt.Add(1)-1)
+		fn, err := compileFunction(expr, name, c.globals, c.opts)
 		if err != nil {
 			return err
 		}
@@ -355,12 +857,11 @@ func (c *Compiler) compileCallExpr(expr *ast.CallExpr) error {
 func (c *Compiler) compileIdent(expr *ast.IdentExpr) error {
 	arg := c.resolveLocal(expr.Name)
 	if arg == -1 {
-		str := obj.NewStr(expr.Name)
-		i, err := c.addConstant(str)
+		i, err := c.globalSlot(expr.Name)
 		if err != nil {
 			return err
 		}
-		c.emitInsts(code.OpGetGlobal, i)
+		c.emitIndexInst(code.OpGetGlobal, i)
 
 	} else {
 		c.emitInsts(code.OpGetLocal, byte(arg))
@@ -380,29 +881,99 @@ func (c *Compiler) resolveLocal(name string) int {
 }
 
 func (c *Compiler) emitInst(opcode byte, o obj.Obj) error {
-	c.code = append(c.code, opcode)
+	if o == nil {
+		c.emit(opcode)
+		return nil
+	}
 
-	if o != nil {
-		idx, err := c.addConstant(o)
-		if err != nil {
-			return err
-		}
-		c.code = append(c.code, idx)
+	idx, err := c.addConstant(o)
+	if err != nil {
+		return err
 	}
 
+	c.emitIndexInst(opcode, idx)
 	return nil
 }
 
+// emitIndexInst emits opcode with an operand indexing the constant pool or the
+// globals table. Indexes that don't fit in a byte are prefixed with OpWide and
+// take two bytes.
+func (c *Compiler) emitIndexInst(opcode byte, idx int) {
+	if idx <= math.MaxUint8 {
+		c.emit(opcode, byte(idx))
+		return
+	}
+
+	c.emit(code.OpWide, opcode, byte(idx>>8), byte(idx))
+}
+
 func (c *Compiler) emitInsts(o1, o2 byte) {
-	c.code = append(c.code, o1, o2)
+	c.emit(o1, o2)
+}
+
+// emit appends an encoded instruction to the code, recording the current
+// source line in the line table when it changes and the stack height after
+// it.
+func (c *Compiler) emit(inst ...byte) {
+	if n := len(c.lines); n == 0 || c.lines[n-1].Line != c.line {
+		c.lines = append(c.lines, obj.LineInfo{Offset: len(c.code), Line: c.line})
+	}
+
+	c.code = append(c.code, inst...)
+
+	op, operand := inst[0], 0
+	switch {
+	case op == code.OpWide:
+		op, operand = inst[1], int(inst[2])<<8|int(inst[3])
+	case len(inst) == 2:
+		operand = int(inst[1])
+	case len(inst) == 3:
+		operand = int(inst[1])<<8 | int(inst[2])
+	}
+	pop, push := code.StackEffect(op, operand)
+	c.height += push - pop
+	if c.height > obj.MaxStack && c.deep == 0 {
+		c.deep = c.line
+	}
+}
+
+var ErrStackTooDeep = fmt.Errorf("expression needs more than %d stack slots", obj.MaxStack)
+
+// checkHeight reports code emitted so far that needs more stack than a frame
+// has, which Verify would reject.
+func (c *Compiler) checkHeight() error {
+	if c.deep > 0 {
+		return fmt.Errorf("line %d: %w", c.deep, ErrStackTooDeep)
+	}
+	return nil
 }
 
 var ErrTooManyconstants = errors.New("too many constants")
 
-func (c *Compiler) addConstant(o obj.Obj) (byte, error) {
-	if len(c.constants) == math.MaxUint8 {
+func (c *Compiler) addConstant(o obj.Obj) (int, error) {
+	switch o.Type() {
+	case obj.NumberObj:
+		if i, ok := c.numbers[math.Float64bits(obj.AsNum(o))]; ok {
+			return i, nil
+		}
+	case obj.StringObj:
+		if i, ok := c.strs[obj.AsStr(o)]; ok {
+			return i, nil
+		}
+	}
+
+	if len(c.constants) > math.MaxUint16 {
 		return 0, ErrTooManyconstants
 	}
 	c.constants = append(c.constants, o)
-	return byte(len(c.constants) - 1), nil
+	i := len(c.constants) - 1
+
+	switch o.Type() {
+	case obj.NumberObj:
+		c.numbers[math.Float64bits(obj.AsNum(o))] = i
+	case obj.StringObj:
+		c.strs[obj.AsStr(o)] = i
+	}
+
+	return i, nil
 }
@@ -0,0 +1,102 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// TestWideConstants checks that constants past the first 256 of a function
+// are loaded through OpWide.
+func TestWideConstants(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("function f() {\n  return 0")
+	for i := 1; i < 300; i++ {
+		fmt.Fprintf(&src, " + %d", i)
+	}
+	src.WriteString("\n}\n")
+	for i := range 300 {
+		fmt.Fprintf(&src, "let s%d = \"%d\"\n", i, i)
+	}
+	src.WriteString("f()\n")
+
+	opts := Options{NoFold: true}
+	fn, err := CompileSource([]byte(src.String()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = obj.Walk(fn, func(f *obj.Function) error {
+		insts, err := obj.Disassemble(f)
+		for _, inst := range insts {
+			if inst.Wide && inst.Opcode == code.OpConstant {
+				return nil
+			}
+		}
+		if err == nil {
+			err = fmt.Errorf("no wide OpConstant in %s", f.Name())
+		}
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	machine := Init(false)
+	machine.SetOptions(opts)
+	res, err := machine.Eval([]byte(src.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.String(), "44850"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	res, err = machine.Eval([]byte("s0 + s299\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.String(), "0299"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestStackTooDeep(t *testing.T) {
+	// nested returns a + (a + ...) with n additions, which keeps n+1 values
+	// on the stack.
+	nested := func(n int) string {
+		return strings.Repeat("a + (", n) + "a" + strings.Repeat(")", n)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		err  bool
+	}{
+		{"script", "let a = 1\nprint " + nested(253) + "\n", false},
+		{"script too deep", "let a = 1\nprint " + nested(254) + "\n", true},
+		{"function", "function f(a) {\n  let b = 1\n  return " + nested(251) + "\n}\n", false},
+		{"function too deep", "function f(a) {\n  let b = 1\n  return " + nested(252) + "\n}\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := CompileSource([]byte(tt.src), Options{})
+			if tt.err {
+				if !errors.Is(err, ErrStackTooDeep) {
+					t.Errorf("got %v, want %v", err, ErrStackTooDeep)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := obj.Verify(fn); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
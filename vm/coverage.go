@@ -0,0 +1,255 @@
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// Coverage records which source lines of each file were executed. A line is
+// counted each time execution enters it. Lines that hold no statement are not
+// tracked.
+type Coverage struct {
+	Files map[string]map[int]uint64
+
+	funcs map[*obj.Function]string
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		Files: make(map[string]map[int]uint64),
+		funcs: make(map[*obj.Function]string),
+	}
+}
+
+// SetCoverage attaches cov to vm. Code run afterwards is recorded under file
+// until the next call; a nil cov stops recording.
+func (vm *VM) SetCoverage(cov *Coverage, file string) {
+	vm.coverage, vm.coverFile = cov, file
+	vm.instrument()
+}
+
+func (vm *VM) Coverage() *Coverage {
+	return vm.coverage
+}
+
+// add registers the lines of fn and its nested functions as belonging to file
+// so that lines that never run are reported. Lines holding only code that
+// cannot run, such as the implicit return at the closing brace of a function
+// that always returns, are left out.
+func (c *Coverage) add(file string, fn *obj.Function) {
+	if _, ok := c.funcs[fn]; ok {
+		return
+	}
+	c.funcs[fn] = file
+
+	lines := c.file(file)
+	for _, offset := range reachable(fn) {
+		if l := fn.Line(offset); l > 0 {
+			lines[l] += 0
+		}
+	}
+
+	for _, k := range fn.Constants() {
+		if nested, ok := k.(*obj.Function); ok {
+			c.add(file, nested)
+		}
+	}
+}
+
+func (c *Coverage) file(name string) map[int]uint64 {
+	lines, ok := c.Files[name]
+	if !ok {
+		lines = make(map[int]uint64)
+		c.Files[name] = lines
+	}
+	return lines
+}
+
+func (c *Coverage) hit(fn *obj.Function, line int) {
+	if file, ok := c.funcs[fn]; ok && line > 0 {
+		c.Files[file][line] += 1
+	}
+}
+
+// Merge adds the counts in other to c.
+func (c *Coverage) Merge(other *Coverage) {
+	for name, lines := range other.Files {
+		dst := c.file(name)
+		for line, n := range lines {
+			dst[line] += n
+		}
+	}
+}
+
+// Summary returns the number of tracked lines in file and how many of them
+// ran.
+func (c *Coverage) Summary(file string) (found, hit int) {
+	for _, n := range c.Files[file] {
+		found += 1
+		if n > 0 {
+			hit += 1
+		}
+	}
+	return found, hit
+}
+
+// WriteLCOV writes c in the LCOV tracefile format.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(c.Files)) {
+		lines := c.Files[name]
+
+		fmt.Fprintf(&b, "TN:\nSF:%s\n", name)
+		for _, line := range slices.Sorted(maps.Keys(lines)) {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line, lines[line])
+		}
+
+		found, hit := c.Summary(name)
+		fmt.Fprintf(&b, "LH:%d\nLF:%d\nend_of_record\n", hit, found)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ReadLCOV parses line coverage from an LCOV tracefile, such as one written
+// by WriteLCOV. Records other than SF and DA are ignored.
+func ReadLCOV(r io.Reader) (*Coverage, error) {
+	c := NewCoverage()
+
+	var lines map[int]uint64
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		kind, value, _ := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		switch kind {
+		case "SF":
+			lines = c.file(value)
+
+		case "DA":
+			if lines == nil {
+				return nil, fmt.Errorf("lcov line %d: DA outside of a file record", n)
+			}
+
+			fields := strings.Split(value, ",")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("lcov line %d: malformed DA record", n)
+			}
+			line, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("lcov line %d: %w", n, err)
+			}
+			count, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("lcov line %d: %w", n, err)
+			}
+			lines[line] += count
+
+		case "end_of_record":
+			lines = nil
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// WriteAnnotated writes src, the source of file, with the hit count of each
+// tracked line in the margin. Lines that were tracked but never ran are
+// marked with #####.
+func (c *Coverage) WriteAnnotated(w io.Writer, file string, src []byte) error {
+	var b strings.Builder
+	lines := c.Files[file]
+
+	found, hit := c.Summary(file)
+	percent := 100.0
+	if found > 0 {
+		percent = 100 * float64(hit) / float64(found)
+	}
+	fmt.Fprintf(&b, "%s: %.1f%% of %d lines\n", file, percent, found)
+
+	text := bytes.Split(bytes.TrimSuffix(src, []byte("\n")), []byte("\n"))
+	for i, line := range text {
+		n, ok := lines[i+1]
+		switch {
+		case !ok:
+			fmt.Fprintf(&b, "%8s | %4d | %s\n", "-", i+1, line)
+		case n == 0:
+			fmt.Fprintf(&b, "%8s | %4d | %s\n", "#####", i+1, line)
+		default:
+			fmt.Fprintf(&b, "%8d | %4d | %s\n", n, i+1, line)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// reachable returns the offsets of the instructions of fn that can run,
+// following jumps from the entry and from the handlers of code that can run.
+func reachable(fn *obj.Function) []int {
+	insts, err := code.Decode(fn.Code())
+	if err != nil {
+		return nil
+	}
+
+	index := make(map[int]int, len(insts))
+	for i, inst := range insts {
+		index[inst.Offset] = i
+	}
+
+	seen := make([]bool, len(insts))
+	work := []int{0}
+	for len(work) > 0 {
+		for len(work) > 0 {
+			i := work[len(work)-1]
+			work = work[:len(work)-1]
+			if i >= len(insts) || seen[i] {
+				continue
+			}
+			seen[i] = true
+
+			switch inst := insts[i]; inst.Op {
+			case code.OpReturn, code.OpThrow:
+			case code.OpJump, code.OpLoop:
+				work = append(work, index[inst.Target()])
+			case code.OpIterNext:
+				work = append(work, index[inst.Target()], i+1)
+			default:
+				work = append(work, i+1)
+			}
+		}
+
+		for _, h := range fn.Handlers() {
+			target := index[h.Target]
+			if seen[target] {
+				continue
+			}
+			for i, inst := range insts {
+				if seen[i] && h.Start <= inst.Offset && inst.Offset < h.End {
+					work = append(work, target)
+					break
+				}
+			}
+		}
+	}
+
+	var offsets []int
+	for i, inst := range insts {
+		if seen[i] {
+			offsets = append(offsets, inst.Offset)
+		}
+	}
+	return offsets
+}
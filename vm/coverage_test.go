@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+)
+
+// loopLineTests give the number of times each line of a loop is entered.
+var loopLineTests = []struct {
+	name string
+	src  string
+	want map[int]uint64
+}{
+	{
+		name: "one line",
+		src:  "function f(n) { return n; }\nfor j in range(0, 5, 1) { f(j); }\n",
+		want: map[int]uint64{1: 6, 2: 6},
+	},
+	{
+		name: "several lines",
+		src:  "function f(n) { return n; }\nfor j in range(0, 5, 1) {\n  f(j)\n}\n",
+		want: map[int]uint64{1: 6, 2: 6, 3: 5},
+	},
+	{
+		name: "after a statement",
+		src:  "function f(n) { return n; }\nlet k = 0; for j in range(0, 5, 1) { f(j); }\n",
+		want: map[int]uint64{1: 6, 2: 6},
+	},
+}
+
+func TestCoverageLoopLines(t *testing.T) {
+	for _, tt := range loopLineTests {
+		for _, opts := range []Options{{}, {NoPeephole: true}} {
+			t.Run(fmt.Sprintf("%s %+v", tt.name, opts), func(t *testing.T) {
+				machine := Init(false)
+				machine.SetOutput(&strings.Builder{})
+				machine.SetOptions(opts)
+				cov := NewCoverage()
+				machine.SetCoverage(cov, "loop.glox")
+
+				if err := machine.ExecuteFile("loop.glox", []byte(tt.src)); err != nil {
+					t.Fatal(err)
+				}
+
+				for line, want := range tt.want {
+					if got := cov.Files["loop.glox"][line]; got != want {
+						t.Errorf("line %d: got %d hits, want %d", line, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCoverageReachableLines(t *testing.T) {
+	src := `function f(n) {
+  return n
+}
+function g(n) {
+  try {
+    throw n
+  } catch (e) {
+    print e
+  }
+}
+f(1)
+`
+	// The closing brace of f only holds its unreachable implicit return.
+	want := map[int]uint64{1: 1, 2: 1, 4: 1, 6: 0, 8: 0, 10: 0, 11: 1}
+
+	for _, opts := range []Options{{}, {NoPeephole: true}} {
+		machine := Init(false)
+		machine.SetOptions(opts)
+		cov := NewCoverage()
+		machine.SetCoverage(cov, "reach.glox")
+		if err := machine.ExecuteFile("reach.glox", []byte(src)); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := cov.Files["reach.glox"]; !maps.Equal(got, want) {
+			t.Errorf("%+v: got %v, want %v", opts, got, want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// Action tells a paused VM how to continue.
+type Action int
+
+const (
+	// Continue runs until the next breakpoint or pause request.
+	Continue Action = iota
+
+	// StepInto stops at the next line, entering called functions.
+	StepInto
+
+	// StepOver stops at the next line of the current function, or of its
+	// caller if it returns.
+	StepOver
+
+	// StepOut stops once the current function returns to its caller.
+	StepOut
+
+	// Abort stops execution with ErrAborted.
+	Abort
+)
+
+type StopReason int
+
+const (
+	StopBreakpoint StopReason = iota
+	StopStep
+	StopPause
+)
+
+var stopReasons = [...]string{
+	StopBreakpoint: "breakpoint",
+	StopStep:       "step",
+	StopPause:      "pause",
+}
+
+func (r StopReason) String() string {
+	return stopReasons[r]
+}
+
+var ErrAborted = errors.New("execution aborted by debugger")
+
+// Stop describes where a VM paused. Execution is stopped before the
+// instruction at Offset in Function runs.
+type Stop struct {
+	Reason   StopReason
+	Function *obj.Function
+	File     string
+	Line     int
+	Offset   int
+}
+
+// Frame is an active call, as seen while the VM is paused.
+type Frame struct {
+	Function *obj.Function
+	File     string
+	Line     int
+	Offset   int
+}
+
+// Variable is a named value in a frame or the globals table.
+type Variable struct {
+	Name  string
+	Value obj.Obj
+}
+
+// Debugger pauses a VM at breakpoints and between steps and calls its handler
+// with the VM stopped. The handler may inspect the VM through the Debugger
+// and returns how execution should continue. The inspection methods must
+// only be called from within the handler.
+//
+// Breakpoints can be changed and Pause called from any goroutine.
+type Debugger struct {
+	vm      *VM
+	handler func(d *Debugger, stop Stop) Action
+
+	mu          sync.Mutex
+	breakpoints map[string]map[int]bool
+	pause       atomic.Bool
+
+	// The action returned by the last stop and the frame and depth it
+	// happened at.
+	mode  Action
+	last  *CalLFrame
+	depth int
+}
+
+func NewDebugger(handler func(d *Debugger, stop Stop) Action) *Debugger {
+	return &Debugger{handler: handler, breakpoints: make(map[string]map[int]bool)}
+}
+
+// SetDebugger attaches d to vm. A nil d detaches the current debugger.
+func (vm *VM) SetDebugger(d *Debugger) {
+	if vm.debugger != nil {
+		vm.debugger.vm = nil
+	}
+	if d != nil {
+		d.vm = vm
+		d.mode = Continue
+	}
+
+	vm.debugger = d
+	vm.instrument()
+}
+
+func (vm *VM) Debugger() *Debugger {
+	return vm.debugger
+}
+
+// SetBreakpoint stops execution whenever it enters line of file. An empty file
+// matches code from any file.
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines, ok := d.breakpoints[file]
+	if !ok {
+		lines = make(map[int]bool)
+		d.breakpoints[file] = lines
+	}
+	lines[line] = true
+}
+
+func (d *Debugger) ClearBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.breakpoints[file], line)
+}
+
+// ClearBreakpoints removes all breakpoints in file.
+func (d *Debugger) ClearBreakpoints(file string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.breakpoints, file)
+}
+
+func (d *Debugger) hasBreakpoint(file string, line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.breakpoints[file][line] || d.breakpoints[""][line]
+}
+
+// Pause stops execution before the next instruction runs. Calling it before
+// the VM starts stops on the first instruction.
+func (d *Debugger) Pause() {
+	d.pause.Store(true)
+}
+
+// check is called before each instruction of frame runs. entered reports
+// whether the instruction starts a new line.
+func (d *Debugger) check(frame *CalLFrame, line int, entered bool) error {
+	depth := d.vm.fp
+	moved := entered || frame != d.last
+
+	var reason StopReason
+	switch {
+	case d.pause.Swap(false):
+		reason = StopPause
+	case entered && d.hasBreakpoint(frame.function.File(), line):
+		reason = StopBreakpoint
+	case d.mode == StepInto && moved,
+		d.mode == StepOver && moved && depth <= d.depth,
+		d.mode == StepOut && depth < d.depth:
+		reason = StopStep
+	default:
+		return nil
+	}
+
+	stop := Stop{
+		Reason:   reason,
+		Function: frame.function,
+		File:     frame.function.File(),
+		Line:     line,
+		Offset:   d.vm.instOffset(frame),
+	}
+
+	d.mode = d.handler(d, stop)
+	d.last, d.depth = frame, depth
+	if d.mode == Abort {
+		d.mode = Continue
+		return ErrAborted
+	}
+
+	return nil
+}
+
+// Frames returns the active calls, innermost first.
+func (d *Debugger) Frames() []Frame {
+	vm := d.vm
+	frames := make([]Frame, 0, vm.fp+1)
+	for i := vm.fp; i >= 0; i-- {
+		frames = append(frames, vm.frameInfo(vm.frames[i]))
+	}
+
+	return frames
+}
+
+// frame returns the frame n calls out from the innermost one, and the end of
+// its part of the stack.
+func (d *Debugger) frame(n int) (*CalLFrame, int, error) {
+	vm := d.vm
+	if n < 0 || n > vm.fp {
+		return nil, 0, fmt.Errorf("no frame %d", n)
+	}
+
+	top := vm.sp
+	if n > 0 {
+		top = vm.frames[vm.fp-n+1].base
+	}
+	return vm.frames[vm.fp-n], top, nil
+}
+
+// Locals returns the local variables in scope in frame n, counted from the
+// innermost frame, in slot order.
+func (d *Debugger) Locals(n int) ([]Variable, error) {
+	frame, top, err := d.frame(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var vars []Variable
+	for _, l := range frame.function.LocalsAt(frame.ip - 1) {
+		if frame.base+l.Slot < top {
+			vars = append(vars, Variable{Name: l.Name, Value: frame.stack[l.Slot].Obj()})
+		}
+	}
+
+	return vars, nil
+}
+
+// Stack returns the values on the stack of frame n, from the callee in slot 0
+// up to the top.
+func (d *Debugger) Stack(n int) ([]obj.Obj, error) {
+	frame, top, err := d.frame(n)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]obj.Obj, 0, top-frame.base)
+	for _, v := range d.vm.stack[frame.base:top] {
+		values = append(values, v.Obj())
+	}
+
+	return values, nil
+}
+
+// Globals returns the defined global variables in slot order.
+func (d *Debugger) Globals() []Variable {
+	globals := d.vm.globals
+
+	var vars []Variable
+	for slot := 0; slot < globals.Len(); slot++ {
+		if v, ok := globals.Get(slot); ok {
+			vars = append(vars, Variable{Name: globals.Name(slot), Value: v.Obj()})
+		}
+	}
+
+	return vars
+}
@@ -0,0 +1,180 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const debugSrc = `function add(a, b) {
+  let sum = a + b
+  return sum
+}
+let x = 1
+let y = add(x, 2)
+print y
+`
+
+// debug runs debugSrc with a breakpoint on line bp, answering the stops with
+// actions in turn and then with Continue. It returns the reason and line of
+// each stop.
+func debug(t *testing.T, bp int, actions ...Action) ([]string, error) {
+	t.Helper()
+
+	var stops []string
+	d := NewDebugger(func(d *Debugger, stop Stop) Action {
+		stops = append(stops, fmt.Sprintf("%s %d", stop.Reason, stop.Line))
+		if len(actions) == 0 {
+			return Continue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	})
+	d.SetBreakpoint("debug.glox", bp)
+
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+	machine.SetDebugger(d)
+	err := machine.ExecuteFile("debug.glox", []byte(debugSrc))
+	return stops, err
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	tests := []struct {
+		name    string
+		bp      int
+		actions []Action
+		want    []string
+	}{
+		{
+			name: "continue",
+			bp:   6,
+			want: []string{"breakpoint 6"},
+		},
+		{
+			name:    "step over",
+			bp:      5,
+			actions: []Action{StepOver, StepOver, StepOver},
+			want:    []string{"breakpoint 5", "step 6", "step 7"},
+		},
+		{
+			name:    "step into",
+			bp:      6,
+			actions: []Action{StepInto, StepInto, StepInto},
+			want:    []string{"breakpoint 6", "step 2", "step 3", "step 6"},
+		},
+		{
+			name:    "step out",
+			bp:      6,
+			actions: []Action{StepInto, StepOut},
+			want:    []string{"breakpoint 6", "step 2", "step 6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := debug(t, tt.bp, tt.actions...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("stopped at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebuggerInspect(t *testing.T) {
+	var frames, locals, outer, stack, globals string
+	var errs []error
+	d := NewDebugger(func(d *Debugger, stop Stop) Action {
+		for _, f := range d.Frames() {
+			frames += fmt.Sprintf("%s:%d ", f.Function.Name(), f.Line)
+		}
+
+		vars, err := d.Locals(0)
+		errs = append(errs, err)
+		for _, v := range vars {
+			locals += fmt.Sprintf("%s=%s ", v.Name, v.Value)
+		}
+
+		vars, err = d.Locals(1)
+		errs = append(errs, err)
+		outer = fmt.Sprint(len(vars))
+
+		values, err := d.Stack(0)
+		errs = append(errs, err)
+		stack = fmt.Sprint(values)
+
+		for _, v := range d.Globals() {
+			globals += fmt.Sprintf("%s=%s ", v.Name, v.Value)
+		}
+
+		if _, err := d.Locals(2); err == nil {
+			t.Error("Locals(2) found a frame outside the script")
+		}
+		return Continue
+	})
+	d.SetBreakpoint("", 3)
+
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+	machine.SetDebugger(d)
+	if err := machine.ExecuteFile("debug.glox", []byte(debugSrc)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ name, got, want string }{
+		{"frames", frames, "add:3 <init>:6 "},
+		{"locals", locals, "a=1 b=2 sum=3 "},
+		{"script locals", outer, "0"},
+		{"stack", stack, "[<fn add> 1 2 3]"},
+		{"globals", globals, "add=<fn add> x=1 "},
+	} {
+		if !strings.HasSuffix(c.got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestDebuggerPauseAndAbort(t *testing.T) {
+	var stops []Stop
+	d := NewDebugger(func(d *Debugger, stop Stop) Action {
+		stops = append(stops, stop)
+		if stop.Reason == StopPause {
+			return Continue
+		}
+		return Abort
+	})
+	d.Pause()
+	d.SetBreakpoint("debug.glox", 2)
+	d.SetBreakpoint("debug.glox", 6)
+	d.ClearBreakpoint("debug.glox", 6)
+
+	machine := Init(false)
+	var out strings.Builder
+	machine.SetOutput(&out)
+	machine.SetDebugger(d)
+	err := machine.ExecuteFile("debug.glox", []byte(debugSrc))
+	if !errors.Is(err, ErrAborted) {
+		t.Errorf("got %v, want %v", err, ErrAborted)
+	}
+
+	if len(stops) != 2 {
+		t.Fatalf("got %d stops, want 2", len(stops))
+	}
+	if s := stops[0]; s.Reason != StopPause || s.Line != 1 || s.Offset != 0 {
+		t.Errorf("first stop: %+v, want a pause at the start", s)
+	}
+	if s := stops[1]; s.Reason != StopBreakpoint || s.Line != 2 || s.Function.Name() != "add" {
+		t.Errorf("second stop: %+v, want the breakpoint in add", s)
+	}
+	if out.Len() != 0 {
+		t.Errorf("printed %q after aborting", out.String())
+	}
+}
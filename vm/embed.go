@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+func (vm *VM) GetGlobal(name string) (obj.Obj, bool) {
+	slot, ok := vm.globals.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+
+	v, ok := vm.globals.Get(slot)
+	if !ok {
+		return nil, false
+	}
+
+	return v.Obj(), true
+}
+
+func (vm *VM) SetGlobal(name string, value obj.Obj) {
+	vm.globals.Set(vm.globals.Slot(name), obj.ObjVal(value))
+}
+
+// Call runs fn with the given arguments on top of the current stack and
+// returns its result. It can be used from the host between or during script
+// execution; on error the stack is restored to where it was before the call.
+func (vm *VM) Call(fn obj.Obj, args ...obj.Obj) (obj.Obj, error) {
+	if len(args) > math.MaxUint8 {
+		return nil, fmt.Errorf("too many arguments: %d", len(args))
+	}
+
+	fp, sp, frame := vm.fp, vm.sp, vm.currFrame
+	if sp+len(args)+1 > stackSize {
+		return nil, fmt.Errorf("stack overflow")
+	}
+
+	callee := obj.ObjVal(fn)
+	vm.push(callee)
+	for _, a := range args {
+		vm.push(obj.ObjVal(a))
+	}
+
+	err := vm.call(callee, byte(len(args)))
+	if err == nil && vm.fp > fp {
+		vm.calls += 1
+		err = vm.run(fp)
+		vm.calls -= 1
+	}
+
+	if err != nil {
+		vm.fp, vm.sp, vm.currFrame = fp, sp, frame
+		return nil, err
+	}
+
+	vm.currFrame = frame
+	return vm.pop().Obj(), nil
+}
+
+// Bind exposes a Go value to scripts as the global name. See obj.FromGo for
+// how values are converted.
+func (vm *VM) Bind(name string, v any) error {
+	o, err := obj.FromGo(v)
+	if err != nil {
+		return err
+	}
+
+	vm.SetGlobal(name, o)
+	return nil
+}
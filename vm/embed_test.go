@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+func TestGlobals(t *testing.T) {
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+
+	if _, ok := machine.GetGlobal("x"); ok {
+		t.Error("undefined global x found")
+	}
+
+	// Referring to y gives it a slot without defining it.
+	if err := machine.Execute([]byte("function f() { return y; }\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := machine.GetGlobal("y"); ok {
+		t.Error("global y found before it was defined")
+	}
+
+	machine.SetGlobal("y", obj.NewNumber(2))
+	if err := machine.Execute([]byte("let x = f() * 3\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	x, ok := machine.GetGlobal("x")
+	if !ok {
+		t.Fatal("global x not found")
+	}
+	if got := x.String(); got != "6" {
+		t.Errorf("x = %s, want 6", got)
+	}
+}
+
+func TestCall(t *testing.T) {
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+	if err := machine.Execute([]byte("function add(a, b) { return a + b; }\nlet n = 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	add, _ := machine.GetGlobal("add")
+	n, _ := machine.GetGlobal("n")
+	missing, _ := machine.GetGlobal("missing")
+
+	tests := []struct {
+		name string
+		fn   obj.Obj
+		args []obj.Obj
+		want string
+		err  string
+	}{
+		{
+			name: "function",
+			fn:   add,
+			args: []obj.Obj{obj.NewNumber(1), obj.NewNumber(2)},
+			want: "3",
+		},
+		{
+			name: "wrong arity",
+			fn:   add,
+			args: []obj.Obj{obj.NewNumber(1)},
+			err:  "expects 2 arguments, got 1",
+		},
+		{
+			name: "not callable",
+			fn:   n,
+			err:  "not callable",
+		},
+		{
+			name: "undefined global",
+			fn:   missing,
+			err:  "not callable",
+		},
+		{
+			name: "runtime error",
+			fn:   add,
+			args: []obj.Obj{obj.NewNumber(1), obj.Nil()},
+			err:  "invalid operation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := machine.Call(tt.fn, tt.args...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if got := res.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+
+			// A failed call must leave the VM usable.
+			if machine.sp != 0 || machine.fp != -1 {
+				t.Errorf("sp = %d, fp = %d after the call", machine.sp, machine.fp)
+			}
+		})
+	}
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"script", "print 1\nreturn 1\n"},
+		{"block", "{\n  return 1\n}\n"},
+		{"loop", "for i in range(0, 2, 1) {\n  return i\n}\n"},
+		{"finally", "try {\n  print 1\n} finally {\n  return 2\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := Init(false)
+			machine.SetOutput(&strings.Builder{})
+
+			err := machine.Execute([]byte(tt.src))
+			if !errors.Is(err, ErrTopLevelReturn) {
+				t.Errorf("Execute: got %v, want %v", err, ErrTopLevelReturn)
+			}
+			if _, err := machine.Eval([]byte(tt.src)); !errors.Is(err, ErrTopLevelReturn) {
+				t.Errorf("Eval: got %v, want %v", err, ErrTopLevelReturn)
+			}
+		})
+	}
+
+	machine := Init(false)
+	res, err := machine.Eval([]byte("function f() { return 2; }\nf() + 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.String(); got != "3" {
+		t.Errorf("Eval = %s, want 3", got)
+	}
+}
+
+func TestBindPanic(t *testing.T) {
+	machine := Init(false)
+	var out strings.Builder
+	machine.SetOutput(&out)
+	if err := machine.Bind("at", func(s []int, i int) int { return s[i] }); err != nil {
+		t.Fatal(err)
+	}
+
+	src := `try {
+  at(nil, 1)
+} catch (e) {
+  print e
+}
+`
+	if err := machine.Execute([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "error: panic: runtime error: index out of range") {
+		t.Errorf("caught %q", got)
+	}
+
+	err := machine.Execute([]byte("at(nil, 1)\n"))
+	if err == nil || !strings.Contains(err.Error(), "panic: runtime error") {
+		t.Errorf("got error %v, want the panic", err)
+	}
+}
@@ -0,0 +1,36 @@
+package vm
+
+import "fmt"
+
+type ErrorKind int
+
+const (
+	SyntaxError ErrorKind = iota
+	CompileError
+	RuntimeError
+)
+
+var errorKinds = [...]string{
+	SyntaxError:  "Syntax Error",
+	CompileError: "Compilation Error",
+	RuntimeError: "Runtime Error",
+}
+
+func (k ErrorKind) String() string {
+	return errorKinds[k]
+}
+
+// Error is returned by Execute and Eval and records which stage of running a
+// script failed.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
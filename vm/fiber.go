@@ -0,0 +1,268 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+const (
+	maxFrames = 64
+	stackSize = maxFrames * math.MaxUint8
+
+	// initStackSize is the stack a context starts with. It grows up to
+	// stackSize as needed, so that idle coroutines and forks stay small.
+	initStackSize = 256
+)
+
+// context is the execution state of a fiber: its call frames and value
+// stack. Switching fibers swaps the context of the VM.
+type context struct {
+	fp        int
+	frames    []*CalLFrame
+	currFrame *CalLFrame
+
+	sp    int
+	stack []obj.Value
+
+	// calls counts host calls into the VM running on this context. A fiber
+	// cannot yield from inside one, as that would leave its Go caller behind.
+	calls int
+}
+
+func newContext() context {
+	return context{
+		fp:     -1,
+		frames: make([]*CalLFrame, maxFrames),
+		stack:  make([]obj.Value, initStackSize),
+	}
+}
+
+// growStack doubles the stack of the running context and points the frames
+// on it at the new one.
+func (vm *VM) growStack() {
+	if len(vm.stack) == stackSize {
+		panic("stack overflow")
+	}
+
+	stack := make([]obj.Value, min(2*len(vm.stack), stackSize))
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	for _, frame := range vm.frames[:vm.fp+1] {
+		frame.stack = stack[frame.base:]
+	}
+}
+
+type FiberStatus int
+
+const (
+	FiberSuspended FiberStatus = iota
+	FiberRunning
+	FiberNormal
+	FiberDead
+)
+
+var fiberStatuses = [...]string{
+	FiberSuspended: "suspended",
+	FiberRunning:   "running",
+	FiberNormal:    "normal",
+	FiberDead:      "dead",
+}
+
+func (s FiberStatus) String() string {
+	return fiberStatuses[s]
+}
+
+// errYield is returned through run by the yield builtin to suspend the
+// running fiber.
+var errYield = errors.New("yield")
+
+// Fiber is a coroutine created by the coroutine builtin. It runs a function
+// on its own frames and stack, suspending where it calls yield, until it
+// returns. A fiber is only resumed by the VM that created it, and a running
+// fiber marks itself normal while it resumes another.
+type Fiber struct {
+	vm      *VM
+	fn      obj.Obj
+	status  FiberStatus
+	started bool
+
+	// ctx is the saved context of the fiber while it is not running.
+	ctx context
+
+	// transfer is the value passed out by the last yield.
+	transfer obj.Value
+}
+
+func (f *Fiber) Status() FiberStatus {
+	return f.status
+}
+
+func (f *Fiber) Type() obj.ObjType {
+	return obj.FiberObj
+}
+
+func (f *Fiber) String() string {
+	return fmt.Sprintf("<coroutine %s>", f.status)
+}
+
+func (vm *VM) coroutine(args []obj.Obj) (obj.Obj, error) {
+	fn := args[0]
+	if t := fn.Type(); t != obj.FuncObj && t != obj.NativeObj {
+		return nil, fmt.Errorf("cannot make a coroutine of %s", t)
+	}
+
+	return &Fiber{vm: vm, fn: fn, ctx: newContext()}, nil
+}
+
+func asFiber(o obj.Obj) (*Fiber, error) {
+	f, ok := o.(*Fiber)
+	if !ok {
+		return nil, fmt.Errorf("expected coroutine, got %s", o.Type())
+	}
+	return f, nil
+}
+
+// resume runs a fiber until it yields or returns, and returns the value it
+// yielded or returned. The first resume passes its remaining arguments to the
+// fiber's function; later ones pass at most one value, which becomes the
+// result of the yield the fiber is suspended in. An error in the fiber ends
+// it and is returned by resume.
+func (vm *VM) resume(args []obj.Obj) (obj.Obj, error) {
+	if len(args) == 0 {
+		return nil, errors.New("resume expects a coroutine")
+	}
+
+	f, err := asFiber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	args = args[1:]
+
+	switch {
+	case f.vm != vm:
+		return nil, errors.New("cannot resume a coroutine created by another vm")
+	case f.status == FiberDead:
+		return nil, errors.New("cannot resume dead coroutine")
+	case f.status != FiberSuspended:
+		return nil, fmt.Errorf("cannot resume %s coroutine", f.status)
+	case f.started && len(args) > 1:
+		return nil, fmt.Errorf("resume expects at most 1 value, got %d", len(args))
+	}
+
+	caller, saved := vm.fiber, vm.context
+	if caller != nil {
+		caller.status = FiberNormal
+	}
+	vm.fiber, vm.context = f, f.ctx
+	f.status = FiberRunning
+
+	if !f.started {
+		f.started = true
+		err = vm.start(f.fn, args)
+	} else {
+		if len(args) == 1 {
+			vm.stack[vm.sp-1] = obj.ObjVal(args[0])
+		}
+		err = vm.run(-1)
+	}
+
+	var res obj.Obj
+	switch err {
+	case errYield:
+		f.status, f.ctx, err = FiberSuspended, vm.context, nil
+		res = f.transfer.Obj()
+		f.transfer = obj.NilVal
+	case nil:
+		f.status, f.ctx = FiberDead, context{}
+		res = vm.pop().Obj()
+	default:
+		f.status, f.ctx = FiberDead, context{}
+	}
+
+	vm.fiber, vm.context = caller, saved
+	if caller != nil {
+		caller.status = FiberRunning
+	}
+	return res, err
+}
+
+// start calls fn on the current context and runs it to its end or first
+// yield.
+func (vm *VM) start(fn obj.Obj, args []obj.Obj) error {
+	if len(args) > math.MaxUint8 {
+		return fmt.Errorf("too many arguments: %d", len(args))
+	}
+
+	callee := obj.ObjVal(fn)
+	vm.push(callee)
+	for _, a := range args {
+		vm.push(obj.ObjVal(a))
+	}
+
+	if err := vm.call(callee, byte(len(args))); err != nil {
+		return err
+	}
+	if vm.fp < 0 {
+		return nil
+	}
+	return vm.run(-1)
+}
+
+// yield suspends the running fiber, passing at most one value out to resume.
+func (vm *VM) yield(args []obj.Obj) (obj.Obj, error) {
+	switch {
+	case vm.fiber == nil:
+		return nil, errors.New("yield outside of a coroutine")
+	case vm.calls > 0:
+		return nil, errors.New("cannot yield across a native call")
+	case len(args) > 1:
+		return nil, fmt.Errorf("yield expects at most 1 value, got %d", len(args))
+	}
+
+	vm.fiber.transfer = obj.NilVal
+	if len(args) == 1 {
+		vm.fiber.transfer = obj.ObjVal(args[0])
+	}
+	return nil, errYield
+}
+
+func status(args []obj.Obj) (obj.Obj, error) {
+	f, err := asFiber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return obj.NewStr(f.status.String()), nil
+}
+
+// iterate returns an iterator over o. Besides the values obj.Iterate accepts,
+// a coroutine is iterated by resuming it until it returns, yielding the
+// values it yields; a function is run as such a coroutine.
+func (vm *VM) iterate(o obj.Obj) (obj.Iterator, error) {
+	switch o.Type() {
+	case obj.FuncObj:
+		f, err := vm.coroutine([]obj.Obj{o})
+		if err != nil {
+			return nil, err
+		}
+		o = f
+	case obj.FiberObj:
+	default:
+		return obj.Iterate(o)
+	}
+
+	f := o.(*Fiber)
+	return obj.NewIterator(func() (obj.Obj, bool, error) {
+		if f.status == FiberDead {
+			return nil, false, nil
+		}
+
+		v, err := vm.resume([]obj.Obj{f})
+		if err != nil || f.status == FiberDead {
+			return nil, false, err
+		}
+		return v, true, nil
+	}), nil
+}
@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCoroutineStackGrowth checks that a coroutine which outgrows its first
+// stack keeps its frames and locals, including across a yield.
+func TestCoroutineStackGrowth(t *testing.T) {
+	src := `function deep(n) {
+  let a = n
+  let b = n * 2
+  let c = n * 3
+  let d = n * 4
+  for i in range(0, n, 1) {
+    return deep(n - 1) + a + b + c + d
+  }
+  yield(n)
+  return 0
+}
+let co = coroutine(fn () { return deep(60); })
+print resume(co)
+`
+	var out strings.Builder
+	machine := Init(false)
+	machine.SetOutput(&out)
+	if err := machine.ExecuteFile("deep.glox", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	co, _ := machine.GetGlobal("co")
+	if n := len(co.(*Fiber).ctx.stack); n <= initStackSize {
+		t.Errorf("coroutine stack has %d slots, it did not grow", n)
+	}
+
+	if err := machine.ExecuteFile("deep.glox", []byte("print resume(co)\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "0\n18300\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	if n := len(machine.stack); n != initStackSize {
+		t.Errorf("main stack has %d slots, want %d", n, initStackSize)
+	}
+}
@@ -0,0 +1,178 @@
+package vm
+
+import (
+	"github.com/sushil-cmd-r/glox/ast"
+	"github.com/sushil-cmd-r/glox/token"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// foldStmts rewrites the expressions in stmts, in place, so that operations
+// on literals are evaluated at compile time. Operations that fail at runtime,
+// such as division by zero or adding a number to a string, are left as is so
+// the VM still reports them.
+func foldStmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		foldStmt(stmt)
+	}
+}
+
+func foldStmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		stmt.Expression = fold(stmt.Expression)
+	case *ast.LetStmt:
+		stmt.Value = fold(stmt.Value)
+	case *ast.AssignStmt:
+		stmt.Name = fold(stmt.Name)
+		stmt.Value = fold(stmt.Value)
+	case *ast.BlockStmt:
+		foldStmts(stmt.Stmts)
+	case *ast.PrintStmt:
+		stmt.Expr = fold(stmt.Expr)
+	case *ast.FuncStmt:
+		foldStmts(stmt.FuncExpr.Body.Stmts)
+	case *ast.ReturnStmt:
+		stmt.Value = fold(stmt.Value)
+	case *ast.ForInStmt:
+		stmt.Iterable = fold(stmt.Iterable)
+		foldStmts(stmt.Body.Stmts)
+	case *ast.ExportStmt:
+		foldStmt(stmt.Decl)
+	case *ast.ThrowStmt:
+		stmt.Value = fold(stmt.Value)
+	case *ast.TryStmt:
+		foldStmts(stmt.Body.Stmts)
+		if stmt.Catch != nil {
+			foldStmts(stmt.Catch.Stmts)
+		}
+		if stmt.Finally != nil {
+			foldStmts(stmt.Finally.Stmts)
+		}
+	}
+}
+
+func fold(expr ast.Expr) ast.Expr {
+	switch expr := expr.(type) {
+	case *ast.GroupExpr:
+		inner := fold(expr.Expression)
+		if isLiteral(inner) {
+			return inner
+		}
+		expr.Expression = inner
+
+	case *ast.UnaryExpr:
+		expr.Left = fold(expr.Left)
+		if folded := foldUnary(expr); folded != nil {
+			return folded
+		}
+
+	case *ast.BinaryExpr:
+		expr.Left = fold(expr.Left)
+		expr.Right = fold(expr.Right)
+		if folded := foldBinary(expr); folded != nil {
+			return folded
+		}
+
+	case *ast.CallExpr:
+		expr.Callee = fold(expr.Callee)
+		for i, arg := range expr.Args {
+			expr.Args[i] = fold(arg)
+		}
+
+	case *ast.GetExpr:
+		expr.Object = fold(expr.Object)
+
+	case *ast.FuncExpr:
+		foldStmts(expr.Body.Stmts)
+	}
+
+	return expr
+}
+
+func foldUnary(expr *ast.UnaryExpr) ast.Expr {
+	switch expr.Op {
+	case token.MINUS:
+		if n, ok := expr.Left.(*ast.NumberLit); ok {
+			return &ast.NumberLit{Value: -n.Value}
+		}
+
+	case token.NOT:
+		if v, ok := literalValue(expr.Left); ok {
+			return &ast.BoolLit{Value: !v.Truthy()}
+		}
+	}
+
+	return nil
+}
+
+func foldBinary(expr *ast.BinaryExpr) ast.Expr {
+	switch expr.Op {
+	case token.EQL, token.NEQ:
+		a, ok := literalValue(expr.Left)
+		if !ok {
+			return nil
+		}
+		b, ok := literalValue(expr.Right)
+		if !ok {
+			return nil
+		}
+
+		return &ast.BoolLit{Value: a.Equal(b) == (expr.Op == token.EQL)}
+	}
+
+	if a, ok := expr.Left.(*ast.StringLit); ok {
+		if b, ok := expr.Right.(*ast.StringLit); ok && expr.Op == token.PLUS {
+			return &ast.StringLit{Value: a.Value + b.Value}
+		}
+		return nil
+	}
+
+	a, ok := expr.Left.(*ast.NumberLit)
+	if !ok {
+		return nil
+	}
+	b, ok := expr.Right.(*ast.NumberLit)
+	if !ok {
+		return nil
+	}
+
+	var res float64
+	switch expr.Op {
+	case token.PLUS:
+		res = a.Value + b.Value
+	case token.MINUS:
+		res = a.Value - b.Value
+	case token.STAR:
+		res = a.Value * b.Value
+	case token.SLASH:
+		if b.Value == 0 {
+			return nil
+		}
+		res = a.Value / b.Value
+	default:
+		return nil
+	}
+
+	return &ast.NumberLit{Value: res}
+}
+
+func isLiteral(expr ast.Expr) bool {
+	_, ok := literalValue(expr)
+	return ok
+}
+
+// literalValue returns the value expr evaluates to if it is a literal.
+func literalValue(expr ast.Expr) (obj.Value, bool) {
+	switch expr := expr.(type) {
+	case *ast.NumberLit:
+		return obj.NumVal(expr.Value), true
+	case *ast.StringLit:
+		return obj.ObjVal(obj.NewStr(expr.Value)), true
+	case *ast.BoolLit:
+		return obj.BoolVal(expr.Value), true
+	case *ast.NilExpr:
+		return obj.NilVal, true
+	default:
+		return obj.Value{}, false
+	}
+}
@@ -0,0 +1,101 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+
+		// folded lists instructions that folding should remove.
+		folded []code.Opcode
+
+		// kept lists instructions that must not be folded.
+		kept []code.Opcode
+	}{
+		{
+			name:   "arithmetic",
+			src:    "-(1 + 2 * 3) / 7\n",
+			want:   "-1",
+			folded: []code.Opcode{code.OpAdd, code.OpMul, code.OpDiv, code.OpNegate},
+		},
+		{
+			name:   "strings",
+			src:    "\"a\" + \"b\"\n",
+			want:   "ab",
+			folded: []code.Opcode{code.OpAdd},
+		},
+		{
+			name:   "equality",
+			src:    "!(1 == 2)\n",
+			want:   "true",
+			folded: []code.Opcode{code.OpEqual, code.OpNot},
+		},
+		{
+			name: "division by zero",
+			src: `let r = nil
+try {
+  r = 1 / 0
+} catch (e) {
+  r = e
+}
+r
+`,
+			want: "error: division by zero",
+			kept: []code.Opcode{code.OpDiv},
+		},
+	}
+
+	eval := func(t *testing.T, src string, opts Options) string {
+		t.Helper()
+
+		machine := Init(false)
+		machine.SetOptions(opts)
+		res, err := machine.Eval([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.String()
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, opts := range []Options{{}, {NoFold: true}} {
+				if got := eval(t, tt.src, opts); got != tt.want {
+					t.Errorf("%+v: got %s, want %s", opts, got, tt.want)
+				}
+			}
+
+			folded := make(map[code.Opcode]bool)
+			unfolded := make(map[code.Opcode]bool)
+			for opts, ops := range map[Options]map[code.Opcode]bool{{}: folded, {NoFold: true}: unfolded} {
+				fn, err := CompileSource([]byte(tt.src), opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := opcodes(fn, ops); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, op := range tt.folded {
+				if folded[op] {
+					t.Errorf("%s left after folding", code.Name(op))
+				}
+				if !unfolded[op] {
+					t.Errorf("no %s with NoFold", code.Name(op))
+				}
+			}
+			for _, op := range tt.kept {
+				if !folded[op] {
+					t.Errorf("%s was folded", code.Name(op))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// InstructionHook is called before each instruction runs with the frame it
+// belongs to, its opcode and the whole VM stack. The stack must not be
+// modified or retained.
+type InstructionHook func(frame Frame, op code.Opcode, stack []obj.Value)
+
+// CallHook is called when a script or native function is called, with the
+// arguments it was passed.
+type CallHook func(callee obj.Obj, args []obj.Value)
+
+// ReturnHook is called when a script or native function returns.
+type ReturnHook func(callee obj.Obj, result obj.Value)
+
+type hooks struct {
+	instruction InstructionHook
+	call        CallHook
+	ret         ReturnHook
+}
+
+// OnInstruction sets the hook called before each instruction runs. A nil hook
+// removes it.
+func (vm *VM) OnInstruction(hook InstructionHook) {
+	vm.hooks.instruction = hook
+	vm.instrument()
+}
+
+// OnCall sets the hook called when a function is called. A nil hook removes
+// it.
+func (vm *VM) OnCall(hook CallHook) {
+	vm.hooks.call = hook
+}
+
+// OnReturn sets the hook called when a function returns. A nil hook removes
+// it.
+func (vm *VM) OnReturn(hook ReturnHook) {
+	vm.hooks.ret = hook
+}
+
+// instrument records whether anything needs to see each instruction, so that
+// run checks a single flag when nothing does.
+func (vm *VM) instrument() {
+	vm.instrumented = vm.profile != nil || vm.coverage != nil || vm.debugger != nil ||
+		vm.hooks.instruction != nil || vm.tracer != nil
+}
+
+func (vm *VM) frameInfo(frame *CalLFrame) Frame {
+	return Frame{
+		Function: frame.function,
+		File:     frame.function.File(),
+		Line:     frame.function.Line(vm.instOffset(frame)),
+		Offset:   vm.instOffset(frame),
+	}
+}
+
+// instOffset returns the offset of the instruction frame is running, which
+// starts at its OpWide prefix if it has one.
+func (vm *VM) instOffset(frame *CalLFrame) int {
+	if vm.wide && frame == vm.currFrame {
+		return frame.ip - 2
+	}
+	return frame.ip - 1
+}
+
+// Trace prints each instruction to w as it runs, preceded by the contents of
+// the stack. A nil w stops tracing. Setting Options.Debug traces to the VM
+// output.
+func (vm *VM) Trace(w io.Writer) {
+	if w == nil {
+		vm.tracer = nil
+	} else {
+		vm.tracer = &tracer{w: w, insts: make(map[*obj.Function]map[int]obj.Instruction)}
+	}
+	vm.instrument()
+}
+
+type tracer struct {
+	w     io.Writer
+	insts map[*obj.Function]map[int]obj.Instruction
+	fn    *obj.Function
+}
+
+func (t *tracer) trace(frame *CalLFrame, offset int, stack []obj.Value) {
+	fn := frame.function
+	insts, ok := t.insts[fn]
+	if !ok {
+		decoded, err := obj.Disassemble(fn)
+		if err != nil {
+			fmt.Fprintln(t.w, err)
+		}
+
+		insts = make(map[int]obj.Instruction, len(decoded))
+		for _, inst := range decoded {
+			insts[inst.Offset] = inst
+		}
+		t.insts[fn] = insts
+	}
+
+	var b strings.Builder
+	if fn != t.fn {
+		t.fn = fn
+		fmt.Fprintf(&b, "== %s ==\n", functionName(fn))
+	}
+
+	b.WriteString("          ")
+	for _, v := range stack {
+		fmt.Fprintf(&b, "[ %s ]", v)
+	}
+	b.WriteByte('\n')
+
+	b.WriteString(insts[offset].Text(true))
+	fmt.Fprintln(t.w, b.String())
+}
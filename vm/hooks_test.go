@@ -0,0 +1,138 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// TestInstructionHookWide checks that an instruction with an OpWide prefix
+// is reported once, at the offset of the prefix.
+func TestInstructionHookWide(t *testing.T) {
+	var src strings.Builder
+	for i := range 300 {
+		fmt.Fprintf(&src, "let g%d = %d\n", i, i)
+	}
+	src.WriteString("print g299\n")
+
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+	fn, err := machine.CompileFile("wide.glox", []byte(src.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insts, err := obj.Disassemble(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]obj.Instruction)
+	for _, inst := range insts {
+		want[inst.Offset] = inst
+	}
+
+	var wide int
+	machine.OnInstruction(func(frame Frame, op code.Opcode, _ []obj.Value) {
+		if op == code.OpWide {
+			t.Errorf("OpWide reported at %d", frame.Offset)
+		}
+		inst, ok := want[frame.Offset]
+		if !ok || inst.Opcode != op {
+			t.Errorf("%s reported at %d, which holds %s", code.Name(op), frame.Offset, inst.Op)
+		}
+		if inst.Wide {
+			wide++
+		}
+	})
+
+	if err := machine.Run(fn); err != nil {
+		t.Fatal(err)
+	}
+	if wide == 0 {
+		t.Error("no wide instructions were reported")
+	}
+}
+
+// TestReturnHookNativeError checks that a native function that fails is still
+// reported as returning, so that call and return hooks stay balanced.
+func TestReturnHookNativeError(t *testing.T) {
+	src := `function f() {
+  send(1, 2)
+}
+try {
+  f()
+} catch (e) {
+  print e
+}
+`
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+
+	var depth int
+	var calls []string
+	machine.OnCall(func(callee obj.Obj, _ []obj.Value) {
+		depth++
+		calls = append(calls, callee.String())
+	})
+	machine.OnReturn(func(obj.Obj, obj.Value) {
+		depth--
+	})
+
+	if err := machine.Execute([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) == 0 || calls[len(calls)-1] != "<native fn send>" {
+		t.Fatalf("calls = %v, want send last", calls)
+	}
+	if depth != 0 {
+		t.Errorf("%d calls left without a return", depth)
+	}
+}
+
+// TestTraceFormat checks that traced instructions are formatted as in the
+// disassembly.
+func TestTraceFormat(t *testing.T) {
+	src := "function f(a) {\n  return a * 2\n}\nprint f(1) + 2\n"
+
+	machine := Init(false)
+	machine.SetOutput(&strings.Builder{})
+	fn, err := machine.CompileFile("trace.glox", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make(map[string]bool)
+	err = obj.Walk(fn, func(f *obj.Function) error {
+		insts, err := obj.Disassemble(f)
+		for _, inst := range insts {
+			want[inst.Text(true)] = true
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	machine.Trace(&out)
+	if err := machine.Run(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	var traced int
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line == "" || line[0] < '0' || line[0] > '9' {
+			continue
+		}
+		traced++
+		if !want[line] {
+			t.Errorf("traced %q, which is not in the disassembly", line)
+		}
+	}
+	if traced == 0 {
+		t.Errorf("no instructions traced:\n%s", out.String())
+	}
+}
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/sushil-cmd-r/glox/vm/code"
@@ -12,23 +13,40 @@ import (
 // 	return vm.run()
 // }
 
-func (vm *VM) run() error {
+func (vm *VM) run(base int) error {
 	for {
 		op := vm.readInst()
+		if vm.instrumented && op != code.OpWide {
+			if err := vm.step(op); err != nil {
+				return err
+			}
+		}
 
 		var err error
 		switch op {
 		case code.OpReturn:
+			if vm.profile != nil {
+				vm.profileReturn()
+			}
+
+			result := vm.pop()
+			if vm.hooks.ret != nil {
+				vm.hooks.ret(vm.currFrame.function, result)
+			}
+			vm.sp = vm.currFrame.base
+			vm.push(result)
+
 			vm.fp -= 1
-			if vm.fp == -1 {
-				vm.pop()
+			if vm.fp == base {
 				return nil
 			}
 			vm.currFrame = vm.frames[vm.fp]
 
+		case code.OpWide:
+			vm.wide = true
+
 		case code.OpConstant:
-			obj := vm.readConstant()
-			vm.push(obj)
+			vm.push(obj.ObjVal(vm.readConstant()))
 
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
 			err = vm.binaryOp(op)
@@ -36,33 +54,46 @@ func (vm *VM) run() error {
 		case code.OpNegate, code.OpNot:
 			err = vm.unaryOp(op)
 
+		case code.OpEqual:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(obj.BoolVal(a.Equal(b)))
+
 		case code.OpNil:
-			vm.push(obj.Nil())
+			vm.push(obj.NilVal)
+
+		case code.OpTrue:
+			vm.push(obj.BoolVal(true))
+
+		case code.OpFalse:
+			vm.push(obj.BoolVal(false))
 
 		case code.OpPop:
 			vm.pop()
 
+		case code.OpPopN:
+			n := int(vm.readInst())
+			if vm.sp < n {
+				panic("stack underflow")
+			}
+			vm.sp -= n
+
 		case code.OpPrint:
-			fmt.Println(vm.pop())
+			vm.outMu.Lock()
+			fmt.Fprintln(vm.out, vm.pop())
+			vm.outMu.Unlock()
 
 		case code.OpDefineGlobal:
-			oj := vm.readConstant()
-			name := obj.AsStr(oj)
-			vm.globals[name] = vm.pop()
+			vm.setGlobal(vm.readGlobal(), vm.pop())
 
 		case code.OpGetGlobal:
-			oj := vm.readConstant()
-			name := obj.AsStr(oj)
-			obj, ok := vm.globals[name]
-			if !ok {
-				return fmt.Errorf("undefined variable: %s", name)
+			var v obj.Value
+			if v, err = vm.getGlobal(vm.readGlobal()); err == nil {
+				vm.push(v)
 			}
-			vm.push(obj)
 
 		case code.OpSetGlobal:
-			oj := vm.readConstant()
-			name := obj.AsStr(oj)
-			vm.globals[name] = vm.pop()
+			vm.setGlobal(vm.readGlobal(), vm.pop())
 
 		case code.OpGetLocal:
 			i := vm.readInst()
@@ -72,28 +103,180 @@ func (vm *VM) run() error {
 			i := vm.readInst()
 			vm.currFrame.stack[i] = vm.pop()
 
+		case code.OpTeeLocal:
+			i := vm.readInst()
+			vm.currFrame.stack[i] = vm.stack[vm.sp-1]
+
+		case code.OpGetProperty:
+			name := obj.AsStr(vm.readConstant())
+			err = vm.getProperty(vm.pop(), name)
+
+		case code.OpSetProperty:
+			name := obj.AsStr(vm.readConstant())
+			value := vm.pop()
+			err = vm.setProperty(vm.pop(), name, value)
+
+		case code.OpIter:
+			var it obj.Iterator
+			it, err = vm.iterate(vm.pop().Obj())
+			if err == nil {
+				vm.push(obj.ObjVal(it))
+			}
+
+		case code.OpIterNext:
+			offset := vm.readShort()
+			var v obj.Value
+			var ok bool
+			switch it := vm.stack[vm.sp-1].Obj().(type) {
+			case obj.ValueIterator:
+				v, ok, err = it.NextValue()
+			case obj.Iterator:
+				var o obj.Obj
+				o, ok, err = it.Next()
+				v = obj.ObjVal(o)
+			default:
+				err = fmt.Errorf("%s is not an iterator", vm.stack[vm.sp-1].Type())
+			}
+
+			if ok {
+				vm.push(v)
+			} else if err == nil {
+				vm.currFrame.ip += offset
+			}
+
+		case code.OpLoop:
+			offset := vm.readShort()
+			vm.currFrame.ip -= offset
+
+		case code.OpJump:
+			offset := vm.readShort()
+			vm.currFrame.ip += offset
+
+		case code.OpThrow:
+			v := vm.pop().Obj()
+			if e, ok := v.(*obj.Error); ok {
+				err = e
+			} else {
+				err = obj.NewError(v, vm.trace())
+			}
+
+		case code.OpImport:
+			var m *Module
+			if m, err = vm.importModule(obj.AsStr(vm.readConstant())); err == nil {
+				vm.push(obj.ObjVal(m))
+			}
+
 		case code.OpCall:
 			args := vm.readInst()
-			if err := vm.call(vm.stack[vm.sp-int(args)-1], args); err != nil {
+			err = vm.call(vm.stack[vm.sp-int(args)-1], args)
+		}
+
+		if err != nil {
+			if err = vm.unwind(err, base); err != nil {
 				return err
 			}
 		}
+	}
+}
 
-		if err != nil {
-			return err
+// unwind looks for a handler for err in the frames above base, innermost
+// first. If there is one, the frames above it are dropped and execution
+// continues at the handler with the error on the stack; otherwise err is
+// returned as an *obj.Error for the caller of run.
+func (vm *VM) unwind(err error, base int) error {
+	if err == errYield || errors.Is(err, ErrAborted) {
+		return err
+	}
+
+	var e *obj.Error
+	if !errors.As(err, &e) {
+		e = obj.WrapError(err, vm.trace())
+	}
+
+	for fp := vm.fp; fp > base; fp-- {
+		frame := vm.frames[fp]
+		h, ok := frame.function.Handler(frame.ip - 1)
+		if !ok {
+			continue
 		}
+
+		for vm.fp > fp {
+			if vm.profile != nil {
+				vm.profileReturn()
+			}
+			if vm.hooks.ret != nil {
+				vm.hooks.ret(vm.currFrame.function, obj.NilVal)
+			}
+			vm.fp -= 1
+			vm.currFrame = vm.frames[vm.fp]
+		}
+
+		vm.sp = frame.base + h.Depth
+		vm.push(obj.ObjVal(e))
+		frame.ip = h.Target
+		return nil
+	}
+
+	return e
+}
+
+// trace describes the active calls, innermost first.
+func (vm *VM) trace() []string {
+	var trace []string
+	for fp := vm.fp; fp >= 0; fp-- {
+		frame := vm.frames[fp]
+		line := frame.function.Line(frame.ip - 1)
+		if file := frame.function.File(); file != "" {
+			trace = append(trace, fmt.Sprintf("%s (%s:%d)", functionName(frame.function), file, line))
+		} else {
+			trace = append(trace, fmt.Sprintf("%s (line %d)", functionName(frame.function), line))
+		}
+	}
+	return trace
+}
+
+// propertyGetter is implemented by objects with properties scripts can read.
+type propertyGetter interface {
+	Get(name string) (obj.Obj, error)
+}
+
+func (vm *VM) getProperty(o obj.Value, name string) error {
+	g, ok := o.Obj().(propertyGetter)
+	if !ok {
+		return fmt.Errorf("%s has no properties", o.Type())
+	}
+
+	prop, err := g.Get(name)
+	if err != nil {
+		return err
 	}
+
+	vm.push(obj.ObjVal(prop))
+	return nil
 }
 
-func (vm *VM) unaryOp(_ byte) error {
+func (vm *VM) setProperty(o obj.Value, name string, value obj.Value) error {
+	ud, ok := o.Obj().(*obj.UserData)
+	if !ok {
+		return fmt.Errorf("%s has no properties", o.Type())
+	}
+
+	return ud.Set(name, value.Obj())
+}
+
+func (vm *VM) unaryOp(op byte) error {
 	a := vm.pop()
 
-	if a.Type() != obj.NumberObj {
+	if op == code.OpNot {
+		vm.push(obj.BoolVal(!a.Truthy()))
+		return nil
+	}
+
+	if !a.IsNum() {
 		return fmt.Errorf("invalid unary operation on %s", a.Type())
 	}
 
-	val := obj.AsNum(a)
-	vm.push(obj.NewNumber(val * -1))
+	vm.push(obj.NumVal(a.AsNum() * -1))
 
 	return nil
 }
@@ -102,14 +285,15 @@ func (vm *VM) binaryOp(op byte) error {
 	b := vm.pop()
 	a := vm.pop()
 
+	if a.IsNum() && b.IsNum() {
+		return vm.binaryOpNumber(op, a, b)
+	}
+
 	if a.Type() != b.Type() {
 		return fmt.Errorf("invalid operation between %s and %s", a.Type(), b.Type())
 	}
 
 	switch a.Type() {
-	case obj.NumberObj:
-		return vm.binaryOpNumber(op, a, b)
-
 	case obj.StringObj:
 		return vm.binaryOpString(op, a, b)
 
@@ -118,23 +302,23 @@ func (vm *VM) binaryOp(op byte) error {
 	}
 }
 
-func (vm *VM) binaryOpString(op byte, a, b obj.Obj) error {
+func (vm *VM) binaryOpString(op byte, a, b obj.Value) error {
 	if op != code.OpAdd {
 		return fmt.Errorf("invalid operation %d between strings", op)
 	}
 
-	sa := obj.AsStr(a)
-	sb := obj.AsStr(b)
+	sa := obj.AsStr(a.Obj())
+	sb := obj.AsStr(b.Obj())
 
-	obj := obj.NewStr(sa + sb)
-	vm.push(obj)
+	str := obj.NewStr(sa + sb)
+	vm.push(obj.ObjVal(str))
 
 	return nil
 }
 
-func (vm *VM) binaryOpNumber(op byte, a, b obj.Obj) error {
-	na := obj.AsNum(a)
-	nb := obj.AsNum(b)
+func (vm *VM) binaryOpNumber(op byte, a, b obj.Value) error {
+	na := a.AsNum()
+	nb := b.AsNum()
 
 	var res float64
 	switch op {
@@ -151,22 +335,20 @@ func (vm *VM) binaryOpNumber(op byte, a, b obj.Obj) error {
 		res = na / nb
 	}
 
-	obj := obj.NewNumber(res)
-	vm.push(obj)
-
+	vm.push(obj.NumVal(res))
 	return nil
 }
 
-func (vm *VM) push(obj obj.Obj) {
+func (vm *VM) push(v obj.Value) {
 	if vm.sp == len(vm.stack) {
-		panic("stack overflow")
+		vm.growStack()
 	}
 
-	vm.stack[vm.sp] = obj
+	vm.stack[vm.sp] = v
 	vm.sp += 1
 }
 
-func (vm *VM) pop() obj.Obj {
+func (vm *VM) pop() obj.Value {
 	if vm.sp <= 0 {
 		panic("stack underflow")
 	}
@@ -180,7 +362,36 @@ func (vm *VM) readInst() byte {
 	return vm.currFrame.function.ReadInst(offset)
 }
 
+// readIndex reads a constant pool or globals table operand, which is two
+// bytes wide after OpWide.
+func (vm *VM) readIndex() int {
+	idx := int(vm.readInst())
+	if vm.wide {
+		idx = idx<<8 | int(vm.readInst())
+		vm.wide = false
+	}
+
+	return idx
+}
+
+// readShort reads a two byte jump operand.
+func (vm *VM) readShort() int {
+	hi := int(vm.readInst())
+	return hi<<8 | int(vm.readInst())
+}
+
 func (vm *VM) readConstant() obj.Obj {
-	idx := vm.readInst()
+	idx := vm.readIndex()
 	return vm.currFrame.function.ReadConstant(idx)
 }
+
+// readGlobal reads a globals table operand and returns the slot it refers to
+// in the globals of the current frame.
+func (vm *VM) readGlobal() int {
+	slot := vm.readIndex()
+	if slots := vm.currFrame.globals; slots != nil {
+		return slots[slot]
+	}
+
+	return slot
+}
@@ -0,0 +1,186 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// countdown is a Go value iterated through its Next method.
+type countdown struct{ n int }
+
+func (c *countdown) Next() (int, bool, error) {
+	if c.n == 0 {
+		return 0, false, nil
+	}
+	if c.n < 0 {
+		return 0, false, errors.New("negative countdown")
+	}
+	if c.n > 100 {
+		panic("countdown too long")
+	}
+	c.n--
+	return c.n + 1, true, nil
+}
+
+// There are no break or continue statements, so a loop is only left early
+// by return or an error.
+func TestForIn(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		err  string
+	}{
+		{
+			name: "list",
+			src:  "for x in list {\n  print x\n}\n",
+			want: "1\na\ntrue\n",
+		},
+		{
+			name: "empty list",
+			src:  "for x in empty {\n  print x\n}\nprint \"done\"\n",
+			want: "done\n",
+		},
+		{
+			name: "map keys",
+			src:  "for k in dict {\n  print k\n}\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "string",
+			src:  "for c in \"hé!\" {\n  print c\n}\n",
+			want: "h\né\n!\n",
+		},
+		{
+			name: "range",
+			src:  "for i in range(0, 3, 1) {\n  print i\n}\nfor i in range(3, 0, -1.5) {\n  print i\n}\n",
+			want: "0\n1\n2\n3\n1.5\n",
+		},
+		{
+			name: "range step",
+			src:  "for i in range(0, 3, 0) {\n  print i\n}\n",
+			err:  "range step cannot be 0",
+		},
+		{
+			name: "nested loops and block locals",
+			src: `let total = 0
+for i in range(0, 3, 1) {
+  for j in range(0, i, 1) {
+    let p = i * j
+    total = total + p
+  }
+}
+print total
+`,
+			want: "2\n",
+		},
+		{
+			name: "return from a loop",
+			src: `function first(xs) {
+  for x in xs {
+    return x
+  }
+}
+print first(list)
+print first(range(5, 6, 1)) + first(range(7, 8, 1))
+`,
+			want: "1\n12\n",
+		},
+		{
+			name: "go iterator",
+			src:  "for n in countdown {\n  print n\n}\n",
+			want: "3\n2\n1\n",
+		},
+		{
+			name: "go iterator error",
+			src:  "for n in broken {\n  print n\n}\n",
+			err:  "negative countdown",
+		},
+		{
+			name: "go iterator panic",
+			src:  "for n in long {\n  print n\n}\n",
+			err:  "panic: countdown too long",
+		},
+		{
+			name: "not iterable",
+			src:  "for x in 1 {\n  print x\n}\n",
+			err:  "number is not iterable",
+		},
+		{
+			name: "generator",
+			src: `let g = coroutine(fn () {
+  yield(1)
+  yield(2)
+  return 3
+})
+for v in g {
+  print v
+}
+print status(g)
+for v in g {
+  print v
+}
+`,
+			want: "1\n2\ndead\n",
+		},
+		{
+			name: "function as generator",
+			src:  "for v in fn () { yield(\"a\"); yield(\"b\"); } {\n  print v\n}\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "generator throws",
+			src: `function gen() {
+  yield(1)
+  throw "boom"
+  yield(2)
+}
+try {
+  for v in gen {
+    print v
+  }
+} catch (e) {
+  print e
+}
+print "after"
+`,
+			want: "1\nerror: boom\nafter\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := Init(false)
+			var out strings.Builder
+			machine.SetOutput(&out)
+			binds := map[string]any{
+				"list":      []any{1, "a", true},
+				"empty":     []int{},
+				"dict":      map[string]int{"b": 2, "a": 1},
+				"countdown": &countdown{n: 3},
+				"broken":    &countdown{n: -1},
+				"long":      &countdown{n: 1000},
+			}
+			for name, v := range binds {
+				if err := machine.Bind(name, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := machine.Execute([]byte(tt.src))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+const marshalSrc = `let total = 0
+function add(n) {
+  total = total + n
+  return total
+}
+function safe(n) {
+  try {
+    throw n
+  } catch (e) {
+    return e
+  } finally {
+    print "finally"
+  }
+}
+function sum(n) {
+  let s = 0
+  for i in range(0, n, 1) {
+    s = s + add(i)
+  }
+  return s
+}
+function outer() {
+  function inner(x) {
+    return x * 2
+  }
+  return inner(21)
+}
+print sum(5)
+print safe(3)
+print outer()
+print total
+`
+
+func TestMarshal(t *testing.T) {
+	const want = "20\nfinally\nerror: 3\n42\n10\n"
+
+	fn, err := CompileSource([]byte(marshalSrc), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := obj.Marshal(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		// prelude defines globals before the script is loaded, so that its
+		// globals are relocated to other slots.
+		prelude string
+	}{
+		{name: "same slots"},
+		{name: "other slots", prelude: "let z = 1\nlet add = nil\n"},
+		{name: "wide slots", prelude: globals(300)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := Init(false)
+			var out strings.Builder
+			machine.SetOutput(&out)
+			if err := machine.Execute([]byte(tt.prelude)); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := machine.Load(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := machine.Run(loaded); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+
+			if tt.prelude == "" {
+				var before, after strings.Builder
+				if err := obj.WriteText(&before, fn); err != nil {
+					t.Fatal(err)
+				}
+				if err := obj.WriteText(&after, loaded); err != nil {
+					t.Fatal(err)
+				}
+				if before.String() != after.String() {
+					t.Errorf("loaded:\n%s\ncompiled:\n%s", &after, &before)
+				}
+			}
+		})
+	}
+}
+
+// globals returns a script declaring n globals.
+func globals(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, "let g%d = %d\n", i, i)
+	}
+	return b.String()
+}
+
+// resum replaces the checksum at the end of b with that of the rest of it.
+func resum(b []byte) []byte {
+	body := b[:len(b)-4]
+	return binary.BigEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	fn, err := CompileSource([]byte(marshalSrc), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := obj.Marshal(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(b []byte) []byte
+		err    string
+	}{
+		{
+			name:   "magic",
+			change: func(b []byte) []byte { b[0] = 'X'; return b },
+			err:    "missing header",
+		},
+		{
+			name:   "version",
+			change: func(b []byte) []byte { b[len("GLOXC")+1]++; return b },
+			err:    "unsupported version",
+		},
+		{
+			name:   "checksum",
+			change: func(b []byte) []byte { b[len(b)/2]++; return b },
+			err:    "checksum mismatch",
+		},
+		{
+			name:   "truncated",
+			change: func(b []byte) []byte { return resum(b[:len(b)/2]) },
+			err:    "offset",
+		},
+		{
+			name:   "trailing data",
+			change: func(b []byte) []byte { return resum(append(b[:len(b)-4], 0, 0, 0, 0, 0)) },
+			err:    "trailing data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.change(append([]byte(nil), data...))
+			_, err := Init(false).Load(b)
+			if !errors.Is(err, obj.ErrBadBytecode) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// ModuleExt is added to import paths that have no extension.
+const ModuleExt = ".glox"
+
+var ErrImportCycle = errors.New("import cycle")
+
+// Module is a script file loaded by import. Its top-level variables are
+// globals of its own, which the functions it defines keep using wherever they
+// are called from; names it does not declare are looked up in the globals of
+// the VM, where the builtins are. Scripts read its exported variables as
+// properties of the module.
+//
+// A VM shares the modules it has loaded with the VMs spawn forks from it, so
+// an assignment to a module variable is seen by all of them. Their globals
+// are read and written under the lock of the table rather than copied.
+type Module struct {
+	file    string
+	globals *obj.Globals
+	exports []string
+
+	// loaded is set once the script has run to the end.
+	loaded bool
+}
+
+// File returns the path the module was loaded from.
+func (m *Module) File() string {
+	return m.file
+}
+
+func (m *Module) Exports() []string {
+	return m.exports
+}
+
+// Get returns the value of the exported variable name.
+func (m *Module) Get(name string) (obj.Obj, error) {
+	if !slices.Contains(m.exports, name) {
+		return nil, fmt.Errorf("module %s does not export %s", m.file, name)
+	}
+
+	slot, ok := m.globals.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("module %s has not defined %s", m.file, name)
+	}
+	v, ok := m.globals.Load(slot)
+	if !ok {
+		return nil, fmt.Errorf("module %s has not defined %s", m.file, name)
+	}
+
+	return v.Obj(), nil
+}
+
+func (m *Module) Type() obj.ObjType {
+	return obj.ModuleObj
+}
+
+func (m *Module) String() string {
+	return fmt.Sprintf("<module %s>", m.file)
+}
+
+// modules caches the modules a VM has imported. Each file is run once, and
+// later imports of it return the same module.
+type modules struct {
+	// byPath indexes modules by absolute path and byGlobals by their
+	// globals table.
+	byPath    map[string]*Module
+	byGlobals map[*obj.Globals]*Module
+
+	// loading lists the modules being run, outermost first.
+	loading []*Module
+}
+
+func (ms *modules) add(path string, m *Module) {
+	if ms.byPath == nil {
+		ms.byPath = make(map[string]*Module)
+		ms.byGlobals = make(map[*obj.Globals]*Module)
+	}
+
+	ms.byPath[path] = m
+	ms.byGlobals[m.globals] = m
+}
+
+func (ms *modules) remove(path string, m *Module) {
+	delete(ms.byPath, path)
+	delete(ms.byGlobals, m.globals)
+}
+
+// clone returns a cache of the modules in ms that have finished loading.
+func (ms *modules) clone() modules {
+	var c modules
+	for path, m := range ms.byPath {
+		if m.loaded {
+			c.add(path, m)
+		}
+	}
+	return c
+}
+
+// SetImportPath sets the directories searched for imported files that are not
+// found next to the script importing them.
+func (vm *VM) SetImportPath(dirs ...string) {
+	vm.importPath = dirs
+}
+
+func (vm *VM) ImportPath() []string {
+	return vm.importPath
+}
+
+// importModule returns the module path refers to from the running function,
+// running the file first if it has not been imported before.
+func (vm *VM) importModule(path string) (*Module, error) {
+	file, err := vm.resolveImport(path, vm.currFrame.function.File())
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := vm.modules.byPath[abs]; ok {
+		if !m.loaded {
+			return nil, vm.importCycle(m)
+		}
+		return m, nil
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Module{file: file, globals: obj.NewGlobals()}
+	fn, err := compileSource(src, m.globals, false, vm.opts)
+	if err != nil {
+		return nil, fmt.Errorf("import %s: %w", file, err)
+	}
+	fn.SetFile(file)
+	m.exports = fn.Exports()
+
+	if vm.coverage != nil {
+		vm.coverage.add(file, fn)
+	}
+
+	vm.modules.add(abs, m)
+	vm.modules.loading = append(vm.modules.loading, m)
+	_, err = vm.Call(fn)
+	vm.modules.loading = vm.modules.loading[:len(vm.modules.loading)-1]
+	if err != nil {
+		vm.modules.remove(abs, m)
+		return nil, err
+	}
+
+	m.loaded = true
+	return m, nil
+}
+
+// importCycle describes the chain of imports that led back to m.
+func (vm *VM) importCycle(m *Module) error {
+	i := slices.Index(vm.modules.loading, m)
+	if i < 0 {
+		return fmt.Errorf("%w: %s is still loading", ErrImportCycle, m.file)
+	}
+
+	var files []string
+	for _, l := range vm.modules.loading[i:] {
+		files = append(files, l.file)
+	}
+	files = append(files, m.file)
+	return fmt.Errorf("%w: %s", ErrImportCycle, strings.Join(files, " -> "))
+}
+
+// resolveImport returns the file that path refers to when imported by a
+// script in from. ModuleExt is added to a path without an extension. A
+// relative path is looked up next to the importing script and then in each
+// directory of the import path, unless it starts with ./ or ../, which only
+// refer to the importing script's directory.
+func (vm *VM) resolveImport(path, from string) (string, error) {
+	name := filepath.FromSlash(path)
+	if filepath.Ext(name) == "" {
+		name += ModuleExt
+	}
+
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+
+	dirs := []string{filepath.Dir(from)}
+	if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+		dirs = append(dirs, vm.importPath...)
+	}
+
+	for _, dir := range dirs {
+		file := filepath.Join(dir, name)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot find module %q in %s", path, strings.Join(dirs, ", "))
+}
+
+// frameGlobals returns the table holding the globals of functions compiled
+// against g, and how their slots map onto it. Modules keep their own table;
+// everything else uses the globals of vm.
+func (vm *VM) frameGlobals(g *obj.Globals) (*obj.Globals, []int) {
+	if _, ok := vm.modules.byGlobals[g]; ok {
+		return g, nil
+	}
+
+	return vm.globals, vm.globalSlots(g)
+}
+
+// getGlobal returns the value of a global of the running function. Names a
+// module does not define are looked up in the globals of vm.
+func (vm *VM) getGlobal(slot int) (obj.Value, error) {
+	table := vm.currFrame.table
+	if table == vm.globals {
+		if v, ok := table.Get(slot); ok {
+			return v, nil
+		}
+		return obj.NilVal, fmt.Errorf("undefined variable: %s", table.Name(slot))
+	}
+
+	// Module tables are shared with forks, see Module.
+	if v, ok := table.Load(slot); ok {
+		return v, nil
+	}
+
+	name := table.Name(slot)
+	if i, ok := vm.globals.Lookup(name); ok {
+		if v, ok := vm.globals.Get(i); ok {
+			return v, nil
+		}
+	}
+
+	return obj.NilVal, fmt.Errorf("undefined variable: %s", name)
+}
+
+// setGlobal assigns v to a global of the running function.
+func (vm *VM) setGlobal(slot int, v obj.Value) {
+	if table := vm.currFrame.table; table == vm.globals {
+		table.Set(slot, v)
+	} else {
+		table.Store(slot, v)
+	}
+}
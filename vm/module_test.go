@@ -0,0 +1,195 @@
+package vm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+		err   string
+		is    error
+
+		// again is run after main.glox by the same VM and prints wantAgain.
+		again     string
+		wantAgain string
+	}{
+		{
+			name: "exports",
+			files: map[string]string{
+				"lib.glox": `let hidden = 2
+export let scale = 10
+export function apply(n) {
+  return n * scale + hidden
+}
+`,
+				"main.glox": `import "lib"
+print lib.scale
+print lib.apply(3)
+`,
+			},
+			want: "10\n32\n",
+		},
+		{
+			name: "not exported",
+			files: map[string]string{
+				"lib.glox":  "let hidden = 2\nexport let shown = 1\n",
+				"main.glox": "import \"lib\"\nprint lib.hidden\n",
+			},
+			err: "does not export hidden",
+		},
+		{
+			name: "runs once",
+			files: map[string]string{
+				"lib.glox":   "print \"lib\"\nexport let n = 1\n",
+				"other.glox": "import \"lib\"\nexport let m = lib.n + 1\n",
+				"main.glox": `import "lib"
+import "other"
+import "./lib.glox"
+print other.m
+`,
+			},
+			want:      "lib\n2\n",
+			again:     "import \"lib\"\nprint lib.n\n",
+			wantAgain: "1\n",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.glox":    "import \"b\"\n",
+				"b.glox":    "import \"a\"\n",
+				"main.glox": "import \"a\"\n",
+			},
+			err: "import cycle: a.glox -> b.glox -> a.glox",
+			is:  ErrImportCycle,
+		},
+		{
+			name: "import path",
+			files: map[string]string{
+				"lib/util.glox": "export let n = 7\n",
+				"main.glox":     "import \"util\"\nprint util.n\n",
+			},
+			want: "7\n",
+		},
+		{
+			name: "relative path skips the import path",
+			files: map[string]string{
+				"lib/util.glox": "export let n = 7\n",
+				"main.glox":     "import \"./util\"\n",
+			},
+			err: "cannot find module",
+		},
+		{
+			name: "failed import",
+			files: map[string]string{
+				"lib.glox":  "print \"lib\"\nthrow \"boom\"\n",
+				"main.glox": "import \"lib\"\n",
+			},
+			want: "lib\n",
+			err:  "boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, src := range tt.files {
+				file := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var out strings.Builder
+			machine := Init(false)
+			machine.SetOutput(&out)
+			machine.SetImportPath(filepath.Join(dir, "lib"))
+
+			main := filepath.Join(dir, "main.glox")
+			err := machine.ExecuteFile(main, []byte(tt.files["main.glox"]))
+			if tt.err != "" {
+				// Error messages name files by their full path.
+				if err == nil || !strings.Contains(strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), ""), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("got error %v, want %v", err, tt.is)
+			}
+
+			if tt.again != "" {
+				out.Reset()
+				if err := machine.ExecuteFile(main, []byte(tt.again)); err != nil {
+					t.Fatal(err)
+				}
+				if got := out.String(); got != tt.wantAgain {
+					t.Errorf("again: got %q, want %q", got, tt.wantAgain)
+				}
+			}
+		})
+	}
+}
+
+// TestSpawnSharesModules runs module functions that assign module globals
+// from a spawned VM and its parent at once. Run it with -race.
+func TestSpawnSharesModules(t *testing.T) {
+	dir := t.TempDir()
+	counter := `let count = 0
+
+export function bump() {
+  count = count + 1
+}
+
+export function get() {
+  return count
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "counter.glox"), []byte(counter), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := `import "counter"
+
+function work() {
+  let n = 0
+  for i in range(0, 200, 1) {
+    counter.bump()
+    n = n + 1
+  }
+  return n
+}
+
+print recv(spawn(work))
+print counter.get()
+let r = spawn(work)
+print work()
+print recv(r)
+`
+	var out strings.Builder
+	machine := Init(false)
+	machine.SetOutput(&out)
+	if err := machine.ExecuteFile(filepath.Join(dir, "main.glox"), []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	// count = count + 1 is not atomic, so the total after the concurrent
+	// runs is not checked.
+	if want := "200\n200\n200\n200\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,196 @@
+package obj
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var (
+	objType   = reflect.TypeOf((*Obj)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// bindFunc wraps a Go func as a native function. Arguments are converted to
+// the parameter types of fn; a trailing error result is returned as a runtime
+// error and multiple remaining results are returned as a list.
+func bindFunc(name string, fn reflect.Value) (Obj, error) {
+	if fn.IsNil() {
+		return Nil(), nil
+	}
+
+	ft := fn.Type()
+	arity := ft.NumIn()
+	if ft.IsVariadic() {
+		arity = -1
+	}
+
+	native := NewNative(name, arity, func(args []Obj) (Obj, error) {
+		return callFunc(fn, args)
+	})
+	return native, nil
+}
+
+func callFunc(fn reflect.Value, args []Obj) (Obj, error) {
+	ft := fn.Type()
+	n := ft.NumIn()
+	if ft.IsVariadic() && len(args) < n-1 {
+		return nil, fmt.Errorf("expects at least %d arguments, got %d", n-1, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, a := range args {
+		t := ft.In(min(i, n-1))
+		if ft.IsVariadic() && i >= n-1 {
+			t = t.Elem()
+		}
+
+		v, err := toGoValue(a, t)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		in[i] = v
+	}
+
+	out, err := callGo(fn, in)
+	if err != nil {
+		return nil, err
+	}
+	if k := len(out); k > 0 && ft.Out(k-1) == errorType {
+		if err := out[k-1]; !err.IsNil() {
+			return nil, err.Interface().(error)
+		}
+		out = out[:k-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return Nil(), nil
+	case 1:
+		return FromGo(out[0].Interface())
+	}
+
+	elems := make([]Obj, len(out))
+	for i, v := range out {
+		e, err := FromGo(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = e
+	}
+	return NewList(elems), nil
+}
+
+// callGo calls fn with in, returning a panic in fn as an error so that it
+// surfaces as a runtime error in the script instead of crashing the host.
+func callGo(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn.Call(in), nil
+}
+
+// toGoValue converts o into a Go value of type t. Interface types other
+// than Obj, such as any, receive the plain Go value from ToGo.
+func toGoValue(o Obj, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t != objType {
+		v := ToGo(o)
+		if v == nil {
+			return reflect.Zero(t), nil
+		}
+
+		if rv := reflect.ValueOf(v); rv.Type().AssignableTo(t) {
+			return rv, nil
+		}
+	}
+
+	if reflect.TypeOf(o).AssignableTo(t) {
+		return reflect.ValueOf(o), nil
+	}
+
+	if o.Type() == NilObj {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	switch o := o.(type) {
+	case *Number:
+		v := reflect.New(t).Elem()
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// Beyond ±2^63 the conversion to int64 below is undefined.
+			if o.value != math.Trunc(o.value) || o.value < math.MinInt64 || o.value >= math.MaxInt64 ||
+				v.OverflowInt(int64(o.value)) {
+				return reflect.Value{}, fmt.Errorf("cannot use %v as %s", o.value, t)
+			}
+			v.SetInt(int64(o.value))
+			return v, nil
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if o.value != math.Trunc(o.value) || o.value < 0 || o.value >= math.MaxUint64 ||
+				v.OverflowUint(uint64(o.value)) {
+				return reflect.Value{}, fmt.Errorf("cannot use %v as %s", o.value, t)
+			}
+			v.SetUint(uint64(o.value))
+			return v, nil
+
+		case reflect.Float32, reflect.Float64:
+			if v.OverflowFloat(o.value) {
+				return reflect.Value{}, fmt.Errorf("cannot use %v as %s", o.value, t)
+			}
+			v.SetFloat(o.value)
+			return v, nil
+		}
+
+	case *Str:
+		if t.Kind() == reflect.String {
+			return reflect.ValueOf(o.String()).Convert(t), nil
+		}
+
+	case *Bool:
+		if t.Kind() == reflect.Bool {
+			return reflect.ValueOf(o.value).Convert(t), nil
+		}
+
+	case *List:
+		if t.Kind() == reflect.Slice {
+			s := reflect.MakeSlice(t, len(o.elems), len(o.elems))
+			for i, e := range o.elems {
+				v, err := toGoValue(e, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				s.Index(i).Set(v)
+			}
+			return s, nil
+		}
+
+	case *Map:
+		if t.Kind() == reflect.Map && t.Key().Kind() == reflect.String {
+			m := reflect.MakeMapWithSize(t, len(o.entries))
+			for k, e := range o.entries {
+				v, err := toGoValue(e, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				m.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), v)
+			}
+			return m, nil
+		}
+
+	case *UserData:
+		if o.value.Type().AssignableTo(t) {
+			return o.value, nil
+		}
+		if o.value.Kind() == reflect.Pointer && !o.value.IsNil() && o.value.Type().Elem().AssignableTo(t) {
+			return o.value.Elem(), nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", o.Type(), t)
+}
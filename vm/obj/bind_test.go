@@ -0,0 +1,52 @@
+package obj
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBindFuncArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   any
+		args []Obj
+		want string
+		err  bool
+	}{
+		{"any number", func(v any) string { return fmt.Sprintf("%T %v", v, v) }, []Obj{NewNumber(1)}, "float64 1", false},
+		{"any string", func(v any) string { return fmt.Sprintf("%T %v", v, v) }, []Obj{NewStr("a")}, "string a", false},
+		{"variadic any", func(vs ...any) string { return fmt.Sprintf("%T", vs[1]) }, []Obj{NewNumber(1), NewBool(true)}, "bool", false},
+		{"any nil", func(v any) bool { return v == nil }, []Obj{Nil()}, "true", false},
+		{"obj", func(o Obj) string { return o.Type().String() }, []Obj{NewNumber(1)}, "number", false},
+		{"int8", func(v int8) int8 { return v }, []Obj{NewNumber(-128)}, "-128", false},
+		{"int8 overflow", func(v int8) int8 { return v }, []Obj{NewNumber(300)}, "", true},
+		{"uint8 negative", func(v uint8) uint8 { return v }, []Obj{NewNumber(-1)}, "", true},
+		{"int fraction", func(v int) int { return v }, []Obj{NewNumber(1.5)}, "", true},
+		{"int64 overflow", func(v int64) int64 { return v }, []Obj{NewNumber(1e19)}, "", true},
+		{"float32 overflow", func(v float32) float32 { return v }, []Obj{NewNumber(1e39)}, "", true},
+		{"panic", func(v int) int { return 1 / v }, []Obj{NewNumber(0)}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := FromGo(tt.fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := fn.(*NativeFn).Call(tt.args)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package obj
+
+import "fmt"
+
+type Bool struct {
+	value bool
+}
+
+var (
+	trueObj  = &Bool{value: true}
+	falseObj = &Bool{value: false}
+)
+
+func NewBool(val bool) *Bool {
+	if val {
+		return trueObj
+	}
+	return falseObj
+}
+
+func (b *Bool) Type() ObjType {
+	return BoolObj
+}
+
+func AsBool(o Obj) bool {
+	return o.(*Bool).value
+}
+
+func (b *Bool) String() string {
+	return fmt.Sprintf("%t", b.value)
+}
@@ -0,0 +1,153 @@
+package obj
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrClosedChan = errors.New("send on closed channel")
+	errCloseTwice = errors.New("close of closed channel")
+)
+
+// Chan is a channel of script values, safe to use from several VMs at once.
+// Sending a value on a channel happens before the matching receive completes,
+// as with Go channels.
+//
+// ch itself is never closed, so that a send racing with Close cannot panic.
+// Closing closes done instead, which wakes blocked senders and receivers.
+type Chan struct {
+	ch   chan Obj
+	done chan struct{}
+
+	// mu guards closing done. err is set before done is closed when the
+	// channel carries the result of a function that failed.
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// NewChan returns a channel that buffers up to size values.
+func NewChan(size int) *Chan {
+	return &Chan{ch: make(chan Obj, size), done: make(chan struct{})}
+}
+
+func (c *Chan) Type() ObjType {
+	return ChanObj
+}
+
+func (c *Chan) String() string {
+	return fmt.Sprintf("<chan %d/%d>", len(c.ch), cap(c.ch))
+}
+
+// Send blocks until v is received or buffered. It returns ErrClosedChan if c
+// is closed first.
+func (c *Chan) Send(v Obj) error {
+	if c.isClosed() {
+		return ErrClosedChan
+	}
+
+	select {
+	case c.ch <- v:
+		return nil
+	case <-c.done:
+		return ErrClosedChan
+	}
+}
+
+func (c *Chan) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+// Recv blocks until a value is available. Once c is closed and drained it
+// returns nil and false, or the error c was closed with.
+func (c *Chan) Recv() (Obj, bool, error) {
+	select {
+	case v := <-c.ch:
+		return v, true, nil
+	case <-c.done:
+		return c.drain()
+	}
+}
+
+// drain returns a value still buffered in c, which is closed, or the result
+// of receiving from a closed channel.
+func (c *Chan) drain() (Obj, bool, error) {
+	select {
+	case v := <-c.ch:
+		return v, true, nil
+	default:
+	}
+
+	if c.err != nil {
+		return nil, false, c.err
+	}
+	return Nil(), false, nil
+}
+
+func (c *Chan) Close() error {
+	return c.CloseWithError(nil)
+}
+
+// CloseWithError closes c so that receivers get err once it is drained.
+func (c *Chan) CloseWithError(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errCloseTwice
+	}
+
+	c.closed, c.err = true, err
+	close(c.done)
+	return nil
+}
+
+// SelectCase is a channel operation for Select: a send of Value when Send is
+// set and a receive otherwise.
+type SelectCase struct {
+	Chan  *Chan
+	Send  bool
+	Value Obj
+}
+
+// Select blocks until one of cases can proceed, performs it and returns its
+// index. For a receive it also returns the value and whether the channel was
+// still open, as Recv does. A send on a closed channel returns ErrClosedChan.
+func Select(cases []SelectCase) (int, Obj, bool, error) {
+	for i, c := range cases {
+		if c.Send && c.Chan.isClosed() {
+			return i, nil, false, ErrClosedChan
+		}
+	}
+
+	// Each case waits on its channel and on the channel being closed.
+	sc := make([]reflect.SelectCase, 0, 2*len(cases))
+	for _, c := range cases {
+		op := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Chan.ch)}
+		if c.Send {
+			op.Dir, op.Send = reflect.SelectSend, reflect.ValueOf(&c.Value).Elem()
+		}
+		done := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Chan.done)}
+		sc = append(sc, op, done)
+	}
+
+	chosen, v, _ := reflect.Select(sc)
+	i, closed := chosen/2, chosen%2 == 1
+	switch {
+	case cases[i].Send && closed:
+		return i, nil, false, ErrClosedChan
+	case cases[i].Send:
+		return i, Nil(), true, nil
+	case closed:
+		o, ok, err := cases[i].Chan.drain()
+		return i, o, ok, err
+	}
+
+	return i, v.Interface().(Obj), true, nil
+}
@@ -0,0 +1,64 @@
+package obj
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChanClose(t *testing.T) {
+	c := NewChan(1)
+	if err := c.Send(NewNumber(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A sender blocked on the full channel is woken by closing it.
+	sent := make(chan error)
+	go func() { sent <- c.Send(NewNumber(2)) }()
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sent; !errors.Is(err, ErrClosedChan) {
+		t.Errorf("blocked send: got %v, want %v", err, ErrClosedChan)
+	}
+
+	if err := c.Send(NewNumber(3)); !errors.Is(err, ErrClosedChan) {
+		t.Errorf("send: got %v, want %v", err, ErrClosedChan)
+	}
+	if _, _, _, err := Select([]SelectCase{{Chan: c, Send: true, Value: Nil()}}); !errors.Is(err, ErrClosedChan) {
+		t.Errorf("select send: got %v, want %v", err, ErrClosedChan)
+	}
+	if err := c.Close(); err == nil {
+		t.Error("closed twice")
+	}
+
+	// The buffered value is still received, then the channel reports that
+	// it is closed.
+	if v, ok, err := c.Recv(); err != nil || !ok || v.String() != "1" {
+		t.Errorf("first receive: got %v, %t, %v", v, ok, err)
+	}
+	if v, ok, err := c.Recv(); err != nil || ok || v != Nil() {
+		t.Errorf("second receive: got %v, %t, %v", v, ok, err)
+	}
+	if i, v, ok, err := Select([]SelectCase{{Chan: c}}); i != 0 || err != nil || ok || v != Nil() {
+		t.Errorf("select receive: got %d, %v, %t, %v", i, v, ok, err)
+	}
+}
+
+func TestChanCloseWithError(t *testing.T) {
+	boom := errors.New("boom")
+	c := NewChan(0)
+
+	got := make(chan error)
+	go func() {
+		_, _, err := c.Recv()
+		got <- err
+	}()
+	if err := c.CloseWithError(boom); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-got; err != boom {
+		t.Errorf("got %v, want %v", err, boom)
+	}
+}
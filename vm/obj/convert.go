@@ -0,0 +1,132 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FromGo converts a Go value into its script representation. Numbers of any
+// kind become a Number, slices and arrays become a List and maps with string
+// keys become a Map. Funcs are bound as native functions and structs as
+// UserData. Values that are already an Obj are returned as is.
+func FromGo(v any) (Obj, error) {
+	switch v := v.(type) {
+	case nil:
+		return Nil(), nil
+	case Obj:
+		return v, nil
+	case float64:
+		return NewNumber(v), nil
+	case string:
+		return NewStr(v), nil
+	case bool:
+		return NewBool(v), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewNumber(float64(rv.Int())), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewNumber(float64(rv.Uint())), nil
+
+	case reflect.Float32, reflect.Float64:
+		return NewNumber(rv.Float()), nil
+
+	case reflect.String:
+		return NewStr(rv.String()), nil
+
+	case reflect.Bool:
+		return NewBool(rv.Bool()), nil
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return Nil(), nil
+		}
+
+		elems := make([]Obj, rv.Len())
+		for i := range elems {
+			e, err := FromGo(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = e
+		}
+		return NewList(elems), nil
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type: %s", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			return Nil(), nil
+		}
+
+		entries := make(map[string]Obj, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			e, err := FromGo(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			entries[iter.Key().String()] = e
+		}
+		return NewMap(entries), nil
+
+	case reflect.Func:
+		return bindFunc(rv.Type().String(), rv)
+
+	case reflect.Struct:
+		return NewUserData(v), nil
+
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return Nil(), nil
+		}
+		if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Struct {
+			return NewUserData(v), nil
+		}
+		return FromGo(rv.Elem().Interface())
+	}
+
+	return nil, fmt.Errorf("unsupported go type: %T", v)
+}
+
+// ToGo converts a script value into a plain Go value: float64, string, bool,
+// nil, []any or map[string]any. UserData yields the wrapped Go value and
+// functions are returned as is.
+func ToGo(o Obj) any {
+	switch o.Type() {
+	case NumberObj:
+		return AsNum(o)
+	case StringObj:
+		return AsStr(o)
+	case BoolObj:
+		return AsBool(o)
+	case NilObj:
+		return nil
+
+	case ListObj:
+		elems := AsList(o)
+		vals := make([]any, len(elems))
+		for i, e := range elems {
+			vals[i] = ToGo(e)
+		}
+		return vals
+
+	case MapObj:
+		entries := AsMap(o)
+		vals := make(map[string]any, len(entries))
+		for k, e := range entries {
+			vals[k] = ToGo(e)
+		}
+		return vals
+
+	case UserDataObj:
+		return o.(*UserData).Value()
+
+	default:
+		return o
+	}
+}
@@ -0,0 +1,261 @@
+package obj
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+)
+
+// Instruction is a decoded instruction of a function with its operands
+// resolved against the function's constants and globals.
+type Instruction struct {
+	Offset   int         `json:"offset"`
+	Opcode   code.Opcode `json:"opcode"`
+	Op       string      `json:"op"`
+	Operands []int       `json:"operands,omitempty"`
+	Wide     bool        `json:"wide,omitempty"`
+
+	// Constant is the constant an OpConstant, property or import
+	// instruction refers to, and Global the name of the global a global
+	// instruction refers to.
+	Constant Obj    `json:"-"`
+	Global   string `json:"global,omitempty"`
+
+	// Target is the offset a jump instruction transfers control to.
+	Target *int `json:"target,omitempty"`
+
+	Line int `json:"line"`
+}
+
+// Arg returns the resolved operand as it is shown in disassembly.
+func (inst Instruction) Arg() string {
+	switch {
+	case inst.Constant != nil:
+		return inst.Constant.String()
+	case inst.Global != "":
+		return inst.Global
+	case inst.Target != nil:
+		return fmt.Sprintf("-> %04d", *inst.Target)
+	case len(inst.Operands) > 0:
+		return fmt.Sprint(inst.Operands[0])
+	default:
+		return ""
+	}
+}
+
+// Text formats inst as a line of WriteText output. The line column shows
+// the source line when showLine is set and a | otherwise.
+func (inst Instruction) Text(showLine bool) string {
+	lineCol := "   |"
+	if showLine {
+		lineCol = fmt.Sprintf("%4d", inst.Line)
+	}
+
+	text := fmt.Sprintf("%04d %s %15s %s", inst.Offset, lineCol, inst.Op, inst.Arg())
+	return strings.TrimRight(text, " ")
+}
+
+func (inst Instruction) MarshalJSON() ([]byte, error) {
+	type instruction Instruction
+	v := struct {
+		instruction
+		Constant *jsonConstant `json:"constant,omitempty"`
+	}{instruction: instruction(inst)}
+
+	if inst.Constant != nil {
+		v.Constant = &jsonConstant{Type: inst.Constant.Type().String(), Value: inst.Constant.String()}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type jsonConstant struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Disassemble decodes the code of fn. It does not descend into nested
+// functions; use Walk to visit those.
+func Disassemble(fn *Function) ([]Instruction, error) {
+	decoded, err := code.Decode(fn.code)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	insts := make([]Instruction, len(decoded))
+	for i, d := range decoded {
+		inst := Instruction{
+			Offset: d.Offset,
+			Opcode: d.Op,
+			Op:     code.Name(d.Op),
+			Wide:   d.Wide,
+			Line:   fn.lines.Line(d.Offset),
+		}
+
+		if code.OperandWidth(d.Op) > 0 {
+			inst.Operands = []int{d.Operand}
+		}
+
+		switch d.Op {
+		case code.OpConstant, code.OpGetProperty, code.OpSetProperty, code.OpImport:
+			if d.Operand >= len(fn.constants) {
+				return nil, fmt.Errorf("%s: offset %d: constant %d out of range", fn, d.Offset, d.Operand)
+			}
+			inst.Constant = fn.constants[d.Operand]
+
+		case code.OpDefineGlobal, code.OpGetGlobal, code.OpSetGlobal:
+			if fn.globals != nil {
+				if d.Operand >= fn.globals.Len() {
+					return nil, fmt.Errorf("%s: offset %d: global %d out of range", fn, d.Offset, d.Operand)
+				}
+				inst.Global = fn.globals.Name(d.Operand)
+			}
+
+		case code.OpIterNext, code.OpLoop, code.OpJump:
+			target := d.Target()
+			inst.Target = &target
+		}
+
+		insts[i] = inst
+	}
+
+	return insts, nil
+}
+
+// Walk calls visit for fn and then for each function nested in its constant
+// pool, depth first, stopping at the first error.
+func Walk(fn *Function, visit func(*Function) error) error {
+	if err := visit(fn); err != nil {
+		return err
+	}
+
+	for _, nested := range nestedFunctions(fn) {
+		if err := Walk(nested, visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteText writes a listing of fn followed by those of the functions in its
+// constant pool, one instruction per line with its offset and source line,
+// and the handler table of any function that has one.
+func WriteText(w io.Writer, fn *Function) error {
+	first := true
+	return Walk(fn, func(f *Function) error {
+		if !first {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		first = false
+		return writeText(w, f)
+	})
+}
+
+func writeText(w io.Writer, fn *Function) error {
+	insts, err := Disassemble(fn)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "<%s>\n", displayName(fn)); err != nil {
+		return err
+	}
+
+	line := -1
+	for _, inst := range insts {
+		if _, err := fmt.Fprintln(w, inst.Text(inst.Line != line)); err != nil {
+			return err
+		}
+		line = inst.Line
+	}
+
+	for _, h := range fn.handlers {
+		if _, err := fmt.Fprintf(w, "handler %04d-%04d -> %04d depth %d\n", h.Start, h.End, h.Target, h.Depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type jsonFunction struct {
+	Name         string          `json:"name"`
+	Arity        int             `json:"arity"`
+	Instructions []Instruction   `json:"instructions"`
+	Handlers     []jsonHandler   `json:"handlers,omitempty"`
+	Functions    []*jsonFunction `json:"functions,omitempty"`
+}
+
+type jsonHandler struct {
+	Start  int `json:"start"`
+	End    int `json:"end"`
+	Target int `json:"target"`
+	Depth  int `json:"depth"`
+}
+
+// WriteJSON writes fn and the functions nested in its constant pool as an
+// indented JSON object.
+func WriteJSON(w io.Writer, fn *Function) error {
+	v, err := toJSON(fn)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+func toJSON(fn *Function) (*jsonFunction, error) {
+	insts, err := Disassemble(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &jsonFunction{Name: displayName(fn), Arity: fn.arity, Instructions: insts}
+	for _, h := range fn.handlers {
+		v.Handlers = append(v.Handlers, jsonHandler(h))
+	}
+	for _, nested := range nestedFunctions(fn) {
+		n, err := toJSON(nested)
+		if err != nil {
+			return nil, err
+		}
+		v.Functions = append(v.Functions, n)
+	}
+
+	return v, nil
+}
+
+func nestedFunctions(fn *Function) []*Function {
+	var fns []*Function
+	for _, c := range fn.constants {
+		if nested, ok := c.(*Function); ok {
+			fns = append(fns, nested)
+		}
+	}
+
+	return fns
+}
+
+func displayName(fn *Function) string {
+	if fn.name == "<init>" {
+		return "script"
+	}
+	return fn.name
+}
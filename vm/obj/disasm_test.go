@@ -0,0 +1,59 @@
+package obj
+
+import (
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+)
+
+func assemble(t *testing.T, insts ...[2]int) []byte {
+	t.Helper()
+
+	var bytecode []byte
+	for _, inst := range insts {
+		var err error
+		if bytecode, err = code.Append(bytecode, code.Opcode(inst[0]), inst[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bytecode
+}
+
+func TestWalk(t *testing.T) {
+	ret := assemble(t, [2]int{int(code.OpNil), 0}, [2]int{int(code.OpReturn), 0})
+	inner := NewFunction("inner", 0, ret, nil, nil, nil)
+	middle := NewFunction("middle", 0, ret, []Obj{inner}, nil, nil)
+	other := NewFunction("other", 0, ret, nil, nil, nil)
+	outer := NewFunction("outer", 0, ret, []Obj{NewNumber(1), middle, other}, nil, nil)
+
+	var names []string
+	err := Walk(outer, func(fn *Function) error {
+		if _, err := Disassemble(fn); err != nil {
+			return err
+		}
+		names = append(names, fn.Name())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"outer", "middle", "inner", "other"}
+	if len(names) != len(want) {
+		t.Fatalf("visited %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("visited %v, want %v", names, want)
+		}
+	}
+}
+
+func TestDisassembleGlobalOutOfRange(t *testing.T) {
+	bytecode := assemble(t, [2]int{int(code.OpGetGlobal), 3}, [2]int{int(code.OpReturn), 0})
+	fn := NewFunction("f", 0, bytecode, nil, nil, NewGlobals())
+
+	if _, err := Disassemble(fn); err == nil {
+		t.Fatal("expected an error for an out of range global")
+	}
+}
@@ -0,0 +1,35 @@
+package obj
+
+// Truthy reports whether o counts as true in a condition. Only nil and false
+// are false.
+func Truthy(o Obj) bool {
+	switch o.Type() {
+	case NilObj:
+		return false
+	case BoolObj:
+		return AsBool(o)
+	default:
+		return true
+	}
+}
+
+// Equal reports whether a and b hold the same value. Strings compare by
+// their interned handle and other heap objects by identity.
+func Equal(a, b Obj) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Type() {
+	case NumberObj:
+		return AsNum(a) == AsNum(b)
+	case StringObj:
+		return a.(*Str).value == b.(*Str).value
+	case BoolObj:
+		return AsBool(a) == AsBool(b)
+	case NilObj:
+		return true
+	default:
+		return a == b
+	}
+}
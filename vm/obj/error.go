@@ -0,0 +1,81 @@
+package obj
+
+import "fmt"
+
+// Error is a thrown value together with the stack trace at the point it was
+// thrown. Runtime errors raised by the VM are thrown as errors whose value is
+// their message. Error implements the error interface so that it can travel
+// through Go code, such as native functions, and still be caught.
+type Error struct {
+	value   Obj
+	message string
+	trace   []string
+
+	// err is the Go error a runtime error was made from.
+	err error
+}
+
+// NewError returns an error carrying value. The message is value itself when
+// it is a string.
+func NewError(value Obj, trace []string) *Error {
+	message := value.String()
+	if s, ok := value.(*Str); ok {
+		message = AsStr(s)
+	}
+	return &Error{value: value, message: message, trace: trace}
+}
+
+// WrapError returns an error for the Go error err, whose value is its
+// message.
+func WrapError(err error, trace []string) *Error {
+	e := NewError(NewStr(err.Error()), trace)
+	e.err = err
+	return e
+}
+
+func (e *Error) Value() Obj {
+	return e.value
+}
+
+func (e *Error) Message() string {
+	return e.message
+}
+
+// Trace returns the frames active when e was thrown, innermost first.
+func (e *Error) Trace() []string {
+	return e.trace
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func (e *Error) Type() ObjType {
+	return ErrorObj
+}
+
+func (e *Error) String() string {
+	return "error: " + e.message
+}
+
+// Get returns the message, value or stack property of e.
+func (e *Error) Get(name string) (Obj, error) {
+	switch name {
+	case "message":
+		return NewStr(e.message), nil
+	case "value":
+		return e.value, nil
+	case "stack":
+		elems := make([]Obj, len(e.trace))
+		for i, t := range e.trace {
+			elems[i] = NewStr(t)
+		}
+		return NewList(elems), nil
+	default:
+		return nil, fmt.Errorf("error has no property %s", name)
+	}
+}
@@ -2,8 +2,8 @@ package obj
 
 import (
 	"fmt"
-
-	"github.com/sushil-cmd-r/glox/vm/code"
+	"os"
+	"sort"
 )
 
 type Function struct {
@@ -12,15 +12,68 @@ type Function struct {
 
 	code      []byte
 	constants []Obj
+	lines     LineTable
+	locals    []LocalInfo
+	handlers  []Handler
+	exports   []string
+	file      string
+
+	globals *Globals
+}
+
+// LineInfo records that the instructions from Offset up to the next entry in
+// a line table were compiled from source line Line.
+type LineInfo struct {
+	Offset int
+	Line   int
+}
+
+// LineTable maps code offsets to source lines, with one entry per run of
+// instructions on the same line.
+type LineTable []LineInfo
+
+// Line returns the source line of the instruction at offset, or 0 if unknown.
+func (t LineTable) Line(offset int) int {
+	i := sort.Search(len(t), func(i int) bool {
+		return t[i].Offset > offset
+	})
+	if i == 0 {
+		return 0
+	}
+
+	return t[i-1].Line
+}
+
+// LocalInfo records that local variable Name lives in stack slot Slot of the
+// function's frame while the instructions from Start up to End run.
+type LocalInfo struct {
+	Name  string
+	Slot  int
+	Start int
+	End   int
 }
 
-func NewFunction(name string, arity int, code []byte, constants []Obj) *Function {
+// Handler catches errors thrown by the instructions from Start up to End by
+// truncating the frame's stack to Depth values, pushing the error and
+// continuing at Target. Handlers of nested try statements come before those
+// of the statements enclosing them.
+type Handler struct {
+	Start  int
+	End    int
+	Target int
+	Depth  int
+}
+
+func NewFunction(name string, arity int, code []byte, constants []Obj, lines LineTable, globals *Globals) *Function {
 	fn := &Function{
 		name:  name,
 		arity: arity,
 
 		code:      code,
 		constants: constants,
+		lines:     lines,
+
+		globals: globals,
 	}
 
 	return fn
@@ -30,6 +83,100 @@ func (f *Function) SetName(name string) {
 	f.name = name
 }
 
+func (f *Function) Name() string {
+	return f.name
+}
+
+func (f *Function) Arity() int {
+	return f.arity
+}
+
+func (f *Function) Constants() []Obj {
+	return f.constants
+}
+
+func (f *Function) Code() []byte {
+	return f.code
+}
+
+func (f *Function) Lines() LineTable {
+	return f.lines
+}
+
+func (f *Function) Line(offset int) int {
+	return f.lines.Line(offset)
+}
+
+// SetLocals records the local variables of f for debuggers.
+func (f *Function) SetLocals(locals []LocalInfo) {
+	f.locals = locals
+}
+
+func (f *Function) Locals() []LocalInfo {
+	return f.locals
+}
+
+// LocalsAt returns the local variables live before the instruction at
+// offset, in slot order.
+func (f *Function) LocalsAt(offset int) []LocalInfo {
+	var live []LocalInfo
+	for _, l := range f.locals {
+		if l.Start <= offset && offset < l.End {
+			live = append(live, l)
+		}
+	}
+
+	sort.SliceStable(live, func(i, j int) bool { return live[i].Slot < live[j].Slot })
+	return live
+}
+
+func (f *Function) SetHandlers(handlers []Handler) {
+	f.handlers = handlers
+}
+
+func (f *Function) Handlers() []Handler {
+	return f.handlers
+}
+
+// Handler returns the innermost handler covering the instruction at offset.
+func (f *Function) Handler(offset int) (Handler, bool) {
+	for _, h := range f.handlers {
+		if h.Start <= offset && offset < h.End {
+			return h, true
+		}
+	}
+	return Handler{}, false
+}
+
+// SetExports records the names of the globals a script exports when it is
+// imported as a module.
+func (f *Function) SetExports(names []string) {
+	f.exports = names
+}
+
+func (f *Function) Exports() []string {
+	return f.exports
+}
+
+// SetFile records the name of the source file f and its nested functions
+// were compiled from.
+func (f *Function) SetFile(file string) {
+	f.file = file
+	for _, c := range f.constants {
+		if nested, ok := c.(*Function); ok {
+			nested.SetFile(file)
+		}
+	}
+}
+
+func (f *Function) File() string {
+	return f.file
+}
+
+func (f *Function) Globals() *Globals {
+	return f.globals
+}
+
 func (f *Function) Type() ObjType {
 	return FuncObj
 }
@@ -42,40 +189,14 @@ func (f *Function) ReadInst(offset int) byte {
 	return f.code[offset]
 }
 
-func (f *Function) ReadConstant(offset byte) Obj {
+func (f *Function) ReadConstant(offset int) Obj {
 	return f.constants[offset]
 }
 
+// PrintCode writes the disassembly of f, without its nested functions, to
+// stdout.
 func (f *Function) PrintCode() {
-	name := f.name
-	if name == "<init>" {
-		name = "script"
+	if err := writeText(os.Stdout, f); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 	}
-	fmt.Printf("<%s>\n", name)
-	for i := 0; i < len(f.code); {
-		i = f.printInst(i)
-	}
-}
-
-func (f *Function) printInst(i int) int {
-	b := f.code[i]
-	inst := code.Opcodes[b]
-	i += 1
-	switch b {
-	case code.OpConstant, code.OpGetGlobal, code.OpSetGlobal, code.OpDefineGlobal:
-		idx := f.code[i]
-		constant := f.constants[idx]
-		i += 1
-		fmt.Printf("%15s %s\n", inst, constant)
-
-	case code.OpGetLocal, code.OpSetLocal, code.OpCall:
-		idx := f.code[i]
-		i += 1
-		fmt.Printf("%15s %d\n", inst, idx)
-
-	default:
-		fmt.Printf("%15s\n", inst)
-	}
-
-	return i
 }
@@ -0,0 +1,110 @@
+package obj
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"unique"
+)
+
+// Globals maps global variable names to numeric slots and holds their values.
+// The compiler resolves every global name to a slot, reserving one for names
+// that are not defined yet, so the VM reads and writes globals by index. A
+// slot without a value is undefined until the script or host assigns it.
+//
+// Names may be looked up from any goroutine, but values belong to the one VM
+// that uses g as its globals, unless they are only read and written with Load
+// and Store.
+type Globals struct {
+	mu    sync.RWMutex
+	slots map[unique.Handle[string]]int
+	names []string
+
+	values  []Value
+	defined []bool
+}
+
+func NewGlobals() *Globals {
+	return &Globals{slots: make(map[unique.Handle[string]]int)}
+}
+
+// Slot returns the slot for name, reserving a new one if needed.
+func (g *Globals) Slot(name string) int {
+	h := unique.Make(name)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if i, ok := g.slots[h]; ok {
+		return i
+	}
+
+	i := len(g.names)
+	g.slots[h] = i
+	g.names = append(g.names, name)
+	g.values = append(g.values, NilVal)
+	g.defined = append(g.defined, false)
+	return i
+}
+
+func (g *Globals) Lookup(name string) (int, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	i, ok := g.slots[unique.Make(name)]
+	return i, ok
+}
+
+func (g *Globals) Name(slot int) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.names[slot]
+}
+
+func (g *Globals) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return len(g.names)
+}
+
+// Get returns the value in slot and whether it has been defined.
+func (g *Globals) Get(slot int) (Value, bool) {
+	return g.values[slot], g.defined[slot]
+}
+
+func (g *Globals) Set(slot int, v Value) {
+	g.values[slot] = v
+	g.defined[slot] = true
+}
+
+// Load is like Get, but may be called while other goroutines Store.
+func (g *Globals) Load(slot int) (Value, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.values[slot], g.defined[slot]
+}
+
+// Store is like Set, but may be called while other goroutines Load or Store.
+func (g *Globals) Store(slot int, v Value) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.values[slot] = v
+	g.defined[slot] = true
+}
+
+// Clone returns a copy of g with the same slots and values.
+func (g *Globals) Clone() *Globals {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return &Globals{
+		slots:   maps.Clone(g.slots),
+		names:   slices.Clone(g.names),
+		values:  slices.Clone(g.values),
+		defined: slices.Clone(g.defined),
+	}
+}
@@ -0,0 +1,178 @@
+package obj
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Iterator produces the values of a sequence one at a time. Next returns
+// false once the sequence is exhausted.
+type Iterator interface {
+	Obj
+	Next() (Obj, bool, error)
+}
+
+type funcIterator struct {
+	next func() (Obj, bool, error)
+}
+
+// NewIterator returns an Iterator whose Next calls next.
+func NewIterator(next func() (Obj, bool, error)) Iterator {
+	return &funcIterator{next: next}
+}
+
+func (it *funcIterator) Next() (Obj, bool, error) {
+	return it.next()
+}
+
+func (it *funcIterator) Type() ObjType {
+	return IteratorObj
+}
+
+func (it *funcIterator) String() string {
+	return "<iterator>"
+}
+
+// ValueIterator is an Iterator that can also produce its values unboxed, so
+// that iterating over numbers does not allocate.
+type ValueIterator interface {
+	Iterator
+	NextValue() (Value, bool, error)
+}
+
+type rangeIterator struct {
+	n, end, step float64
+}
+
+// Range returns an iterator over the numbers from start up to, but not
+// including, end in increments of step.
+func Range(start, end, step float64) (Iterator, error) {
+	if step == 0 {
+		return nil, errors.New("range step cannot be 0")
+	}
+
+	return &rangeIterator{n: start, end: end, step: step}, nil
+}
+
+func (it *rangeIterator) NextValue() (Value, bool, error) {
+	if (it.step > 0 && it.n >= it.end) || (it.step < 0 && it.n <= it.end) {
+		return NilVal, false, nil
+	}
+	v := it.n
+	it.n += it.step
+	return NumVal(v), true, nil
+}
+
+func (it *rangeIterator) Next() (Obj, bool, error) {
+	v, ok, err := it.NextValue()
+	if !ok {
+		return nil, false, err
+	}
+	return v.Obj(), true, nil
+}
+
+func (it *rangeIterator) Type() ObjType {
+	return IteratorObj
+}
+
+func (it *rangeIterator) String() string {
+	return "<iterator>"
+}
+
+// Iterate returns an iterator over o. Lists yield their elements, maps their
+// keys in sorted order and strings their characters; an Iterator yields its
+// own values.
+//
+// UserData is iterable when the wrapped value has a Next method returning a
+// value and whether there was one, optionally followed by an error, or an
+// Iter method returning something iterable.
+func Iterate(o Obj) (Iterator, error) {
+	switch o := o.(type) {
+	case Iterator:
+		return o, nil
+
+	case *List:
+		i := 0
+		return NewIterator(func() (Obj, bool, error) {
+			if i >= len(o.elems) {
+				return nil, false, nil
+			}
+			i += 1
+			return o.elems[i-1], true, nil
+		}), nil
+
+	case *Map:
+		keys := o.Keys()
+		return NewIterator(func() (Obj, bool, error) {
+			if len(keys) == 0 {
+				return nil, false, nil
+			}
+			k := keys[0]
+			keys = keys[1:]
+			return NewStr(k), true, nil
+		}), nil
+
+	case *Str:
+		s := AsStr(o)
+		return NewIterator(func() (Obj, bool, error) {
+			if s == "" {
+				return nil, false, nil
+			}
+			_, n := utf8.DecodeRuneInString(s)
+			c := s[:n]
+			s = s[n:]
+			return NewStr(c), true, nil
+		}), nil
+
+	case *UserData:
+		return o.iterate()
+	}
+
+	return nil, fmt.Errorf("%s is not iterable", o.Type())
+}
+
+func (u *UserData) iterate() (Iterator, error) {
+	if m := u.value.MethodByName("Iter"); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		out, err := callGo(m, nil)
+		if err != nil {
+			return nil, err
+		}
+		o, err := FromGo(out[0].Interface())
+		if err != nil {
+			return nil, err
+		}
+		return Iterate(o)
+	}
+
+	m := u.value.MethodByName("Next")
+	if !m.IsValid() || !isNextMethod(m.Type()) {
+		return nil, fmt.Errorf("%s is not iterable", u.value.Type())
+	}
+
+	return NewIterator(func() (Obj, bool, error) {
+		out, err := callGo(m, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(out) == 3 && !out[2].IsNil() {
+			return nil, false, out[2].Interface().(error)
+		}
+		if !out[1].Bool() {
+			return nil, false, nil
+		}
+
+		v, err := FromGo(out[0].Interface())
+		return v, err == nil, err
+	}), nil
+}
+
+// isNextMethod reports whether t is func() (T, bool) or func() (T, bool,
+// error).
+func isNextMethod(t reflect.Type) bool {
+	if t.NumIn() != 0 || t.NumOut() < 2 || t.NumOut() > 3 || t.Out(1).Kind() != reflect.Bool {
+		return false
+	}
+	return t.NumOut() == 2 || t.Out(2) == errorType
+}
@@ -0,0 +1,28 @@
+package obj
+
+import "strings"
+
+type List struct {
+	elems []Obj
+}
+
+func NewList(elems []Obj) *List {
+	return &List{elems: elems}
+}
+
+func (l *List) Type() ObjType {
+	return ListObj
+}
+
+func AsList(o Obj) []Obj {
+	return o.(*List).elems
+}
+
+func (l *List) String() string {
+	elems := make([]string, len(l.elems))
+	for i, e := range l.elems {
+		elems[i] = e.String()
+	}
+
+	return "[" + strings.Join(elems, ", ") + "]"
+}
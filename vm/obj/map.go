@@ -0,0 +1,44 @@
+package obj
+
+import (
+	"sort"
+	"strings"
+)
+
+type Map struct {
+	entries map[string]Obj
+}
+
+func NewMap(entries map[string]Obj) *Map {
+	if entries == nil {
+		entries = make(map[string]Obj)
+	}
+	return &Map{entries: entries}
+}
+
+func (m *Map) Type() ObjType {
+	return MapObj
+}
+
+func AsMap(o Obj) map[string]Obj {
+	return o.(*Map).entries
+}
+
+func (m *Map) Keys() []string {
+	keys := make([]string, 0, len(m.entries))
+	for k := range m.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (m *Map) String() string {
+	var entries []string
+	for _, k := range m.Keys() {
+		entries = append(entries, k+": "+m.entries[k].String())
+	}
+
+	return "{" + strings.Join(entries, ", ") + "}"
+}
@@ -0,0 +1,394 @@
+package obj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+)
+
+// A compiled script is stored as
+//
+//	magic    "GLOXC"
+//	version  uint16
+//	globals  count, then each global name in slot order
+//	function the top-level function
+//	checksum CRC-32 (IEEE) of everything before it, uint32
+//
+// A function is its name, arity, code, line table, local variable table,
+// exception handler table, exported names and constant pool. Numbers
+// are unsigned varints or length-prefixed byte strings unless noted, and
+// multi-byte fixed-size values are big-endian.
+const (
+	bytecodeMagic   = "GLOXC"
+	BytecodeVersion = 4
+)
+
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagFunction
+	tagNil
+	tagBool
+)
+
+var ErrBadBytecode = errors.New("invalid bytecode")
+
+// IsBytecode reports whether data starts with the compiled script header.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(bytecodeMagic))
+}
+
+// Marshal encodes fn, its nested functions and the names of the globals it
+// refers to.
+func Marshal(fn *Function) ([]byte, error) {
+	buf := []byte(bytecodeMagic)
+	buf = binary.BigEndian.AppendUint16(buf, BytecodeVersion)
+
+	var names []string
+	if fn.globals != nil {
+		names = fn.globals.names
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		buf = appendString(buf, name)
+	}
+
+	buf, err := appendFunction(buf, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf)), nil
+}
+
+func appendFunction(buf []byte, fn *Function) ([]byte, error) {
+	buf = appendString(buf, fn.name)
+	buf = binary.AppendUvarint(buf, uint64(fn.arity))
+	buf = appendBytes(buf, fn.code)
+
+	buf = binary.AppendUvarint(buf, uint64(len(fn.lines)))
+	for _, l := range fn.lines {
+		buf = binary.AppendUvarint(buf, uint64(l.Offset))
+		buf = binary.AppendUvarint(buf, uint64(l.Line))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(fn.locals)))
+	for _, l := range fn.locals {
+		buf = appendString(buf, l.Name)
+		buf = binary.AppendUvarint(buf, uint64(l.Slot))
+		buf = binary.AppendUvarint(buf, uint64(l.Start))
+		buf = binary.AppendUvarint(buf, uint64(l.End))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(fn.handlers)))
+	for _, h := range fn.handlers {
+		buf = binary.AppendUvarint(buf, uint64(h.Start))
+		buf = binary.AppendUvarint(buf, uint64(h.End))
+		buf = binary.AppendUvarint(buf, uint64(h.Target))
+		buf = binary.AppendUvarint(buf, uint64(h.Depth))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(fn.exports)))
+	for _, name := range fn.exports {
+		buf = appendString(buf, name)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(fn.constants)))
+	for _, c := range fn.constants {
+		switch c := c.(type) {
+		case *Number:
+			buf = append(buf, tagNumber)
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(c.value))
+		case *Str:
+			buf = append(buf, tagString)
+			buf = appendString(buf, c.String())
+		case *Function:
+			var err error
+			buf = append(buf, tagFunction)
+			if buf, err = appendFunction(buf, c); err != nil {
+				return nil, err
+			}
+		case *null:
+			buf = append(buf, tagNil)
+		case *Bool:
+			buf = append(buf, tagBool)
+			if c.value {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		default:
+			return nil, fmt.Errorf("cannot marshal %s constant in %s", c.Type(), fn)
+		}
+	}
+
+	return buf, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// Unmarshal decodes a compiled script produced by Marshal. Global names are
+// resolved to slots in globals and the code is rewritten to use them, so the
+// function can run on any VM using that table. The result is checked with
+// Verify before it is returned.
+func Unmarshal(data []byte, globals *Globals) (*Function, error) {
+	header := len(bytecodeMagic) + 2
+	if len(data) < header+4 || !IsBytecode(data) {
+		return nil, fmt.Errorf("%w: missing header", ErrBadBytecode)
+	}
+
+	if v := binary.BigEndian.Uint16(data[len(bytecodeMagic):]); v != BytecodeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBadBytecode, v)
+	}
+
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBadBytecode)
+	}
+
+	r := &reader{data: body, offset: header}
+	n := r.length()
+	slots := make([]int, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		slots = append(slots, globals.Slot(r.string()))
+	}
+
+	fn := r.function(globals, slots)
+	if r.err == nil && r.offset != len(r.data) {
+		r.fail("trailing data")
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if err := Verify(fn); err != nil {
+		return nil, err
+	}
+
+	return fn, nil
+}
+
+type reader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *reader) fail(format string, args ...any) {
+	if r.err == nil {
+		msg := fmt.Sprintf(format, args...)
+		r.err = fmt.Errorf("%w: offset %d: %s", ErrBadBytecode, r.offset, msg)
+	}
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.data[r.offset:])
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.offset += n
+	return v
+}
+
+// length reads a count or size, which can be no larger than the rest of the
+// data.
+func (r *reader) length() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)-r.offset) {
+		r.fail("length %d out of range", n)
+		return 0
+	}
+	return int(n)
+}
+
+// int reads an offset or index, which relocate and Verify check further.
+func (r *reader) int() int {
+	n := r.uvarint()
+	if n > math.MaxInt32 {
+		r.fail("value %d out of range", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data)-r.offset {
+		r.fail("unexpected end of data")
+		return nil
+	}
+
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *reader) string() string {
+	return string(r.bytes(r.length()))
+}
+
+func (r *reader) function(globals *Globals, slots []int) *Function {
+	name := r.string()
+	arity := r.length()
+	bytecode := bytes.Clone(r.bytes(r.length()))
+
+	lines := make(LineTable, r.length())
+	for i := range lines {
+		lines[i] = LineInfo{Offset: int(r.uvarint()), Line: int(r.uvarint())}
+	}
+
+	locals := make([]LocalInfo, r.length())
+	for i := range locals {
+		locals[i] = LocalInfo{Name: r.string(), Slot: r.int(), Start: r.int(), End: r.int()}
+	}
+
+	handlers := make([]Handler, r.length())
+	for i := range handlers {
+		handlers[i] = Handler{Start: r.int(), End: r.int(), Target: r.int(), Depth: r.int()}
+	}
+
+	exports := make([]string, r.length())
+	for i := range exports {
+		exports[i] = r.string()
+	}
+
+	constants := make([]Obj, r.length())
+	for i := range constants {
+		if r.err != nil {
+			return nil
+		}
+
+		switch tag := r.bytes(1); {
+		case tag == nil:
+		case tag[0] == tagNumber:
+			if b := r.bytes(8); b != nil {
+				constants[i] = NewNumber(math.Float64frombits(binary.BigEndian.Uint64(b)))
+			}
+		case tag[0] == tagString:
+			constants[i] = NewStr(r.string())
+		case tag[0] == tagFunction:
+			constants[i] = r.function(globals, slots)
+		case tag[0] == tagNil:
+			constants[i] = Nil()
+		case tag[0] == tagBool:
+			if b := r.bytes(1); b != nil {
+				constants[i] = NewBool(b[0] != 0)
+			}
+		default:
+			r.fail("unknown constant tag %d", tag[0])
+		}
+	}
+
+	if r.err != nil {
+		return nil
+	}
+
+	bytecode, lines, err := relocate(bytecode, lines, locals, handlers, slots)
+	if err != nil {
+		r.fail("%s: %s", name, err)
+		return nil
+	}
+
+	fn := NewFunction(name, arity, bytecode, constants, lines, globals)
+	fn.SetLocals(locals)
+	fn.SetHandlers(handlers)
+	fn.SetExports(exports)
+	return fn
+}
+
+// relocate rewrites the global slot operands in bytecode using slots, which
+// maps the slots the code was compiled against to those of the loading table.
+// Operands may change width, so jumps and line table, local variable and
+// handler offsets are moved to match; locals and handlers are updated in
+// place.
+func relocate(bytecode []byte, lines LineTable, locals []LocalInfo, handlers []Handler, slots []int) ([]byte, LineTable, error) {
+	insts, err := code.Decode(bytecode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	offsets := make(map[int]int, len(insts)+1)
+	var out []byte
+	var jumps []code.Instruction
+	for _, inst := range insts {
+		offsets[inst.Offset] = len(out)
+		if code.IsJump(inst.Op) {
+			jumps = append(jumps, inst)
+		}
+
+		switch inst.Op {
+		case code.OpDefineGlobal, code.OpGetGlobal, code.OpSetGlobal:
+			if inst.Operand >= len(slots) {
+				return nil, nil, fmt.Errorf("offset %d: global slot %d out of range", inst.Offset, inst.Operand)
+			}
+			inst.Operand = slots[inst.Operand]
+		}
+
+		if out, err = code.Append(out, inst.Op, inst.Operand); err != nil {
+			return nil, nil, err
+		}
+	}
+	offsets[len(bytecode)] = len(out)
+
+	// Widened operands move the instructions after them, so jumps are
+	// pointed at the new offsets of their targets.
+	for _, inst := range jumps {
+		target, ok := offsets[inst.Target()]
+		if !ok {
+			return nil, nil, fmt.Errorf("offset %d: jump to %d is not an instruction", inst.Offset, inst.Target())
+		}
+		if err := code.PatchJump(out, offsets[inst.Offset], target); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	relocated := make(LineTable, len(lines))
+	for i, l := range lines {
+		offset, ok := offsets[l.Offset]
+		if !ok {
+			return nil, nil, fmt.Errorf("line table offset %d is not an instruction", l.Offset)
+		}
+		relocated[i] = LineInfo{Offset: offset, Line: l.Line}
+	}
+
+	for i, l := range locals {
+		start, ok := offsets[l.Start]
+		end, ok2 := offsets[l.End]
+		if !ok || !ok2 || start > end {
+			return nil, nil, fmt.Errorf("local %s has invalid range %d-%d", l.Name, l.Start, l.End)
+		}
+		locals[i].Start, locals[i].End = start, end
+	}
+
+	for i, h := range handlers {
+		start, ok := offsets[h.Start]
+		end, ok2 := offsets[h.End]
+		target, ok3 := offsets[h.Target]
+		if !ok || !ok2 || !ok3 || start > end {
+			return nil, nil, fmt.Errorf("handler %d has invalid range %d-%d or target %d", i, h.Start, h.End, h.Target)
+		}
+		handlers[i] = Handler{Start: start, End: end, Target: target, Depth: h.Depth}
+	}
+
+	return out, relocated, nil
+}
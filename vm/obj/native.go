@@ -0,0 +1,48 @@
+package obj
+
+import "fmt"
+
+// NativeFn is a function implemented in Go. An arity of -1 accepts any
+// number of arguments.
+type NativeFn struct {
+	name  string
+	arity int
+
+	fn func(args []Obj) (Obj, error)
+}
+
+func NewNative(name string, arity int, fn func(args []Obj) (Obj, error)) *NativeFn {
+	return &NativeFn{name: name, arity: arity, fn: fn}
+}
+
+func (n *NativeFn) Name() string {
+	return n.name
+}
+
+func (n *NativeFn) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFn) Call(args []Obj) (Obj, error) {
+	if n.arity >= 0 && len(args) != n.arity {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", n, n.arity, len(args))
+	}
+
+	res, err := n.fn(args)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		res = Nil()
+	}
+
+	return res, nil
+}
+
+func (n *NativeFn) Type() ObjType {
+	return NativeObj
+}
+
+func (n *NativeFn) String() string {
+	return fmt.Sprintf("<native fn %s>", n.name)
+}
@@ -2,8 +2,10 @@ package obj
 
 type null struct{}
 
+var nilObj = &null{}
+
 func Nil() *null {
-	return &null{}
+	return nilObj
 }
 
 func (*null) Type() ObjType {
@@ -13,14 +13,32 @@ const (
 	NilObj
 	BoolObj
 	FuncObj
+	ListObj
+	MapObj
+	NativeObj
+	UserDataObj
+	ChanObj
+	FiberObj
+	IteratorObj
+	ErrorObj
+	ModuleObj
 )
 
 var objTypes = [...]string{
-	NumberObj: "number",
-	StringObj: "string",
-	NilObj:    "<nil>",
-	BoolObj:   "boolean",
-	FuncObj:   "FuncObj",
+	NumberObj:   "number",
+	StringObj:   "string",
+	NilObj:      "<nil>",
+	BoolObj:     "boolean",
+	FuncObj:     "FuncObj",
+	ListObj:     "list",
+	MapObj:      "map",
+	NativeObj:   "native",
+	UserDataObj: "userdata",
+	ChanObj:     "chan",
+	FiberObj:    "coroutine",
+	IteratorObj: "iterator",
+	ErrorObj:    "error",
+	ModuleObj:   "module",
 }
 
 func (ot ObjType) String() string {
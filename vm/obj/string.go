@@ -1,21 +1,29 @@
 package obj
 
+import "unique"
+
+// Str holds an interned string. Two strings with the same content share a
+// handle, so comparing them is a pointer comparison.
 type Str struct {
-	value string
+	value unique.Handle[string]
 }
 
 func NewStr(val string) *Str {
-	return &Str{value: val}
+	return &Str{value: unique.Make(val)}
 }
 
 func (s *Str) Type() ObjType {
 	return StringObj
 }
 
+func (s *Str) Handle() unique.Handle[string] {
+	return s.value
+}
+
 func AsStr(o Obj) string {
-	return o.(*Str).value
+	return o.(*Str).value.Value()
 }
 
 func (s *Str) String() string {
-	return s.value
+	return s.value.Value()
 }
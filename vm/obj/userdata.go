@@ -0,0 +1,77 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// UserData wraps an arbitrary Go struct so scripts can read and write its
+// exported fields and call its methods. Fields are only writable when the
+// wrapped value was bound through a pointer.
+type UserData struct {
+	value reflect.Value
+}
+
+func NewUserData(v any) *UserData {
+	return &UserData{value: reflect.ValueOf(v)}
+}
+
+func (u *UserData) Value() any {
+	return u.value.Interface()
+}
+
+func (u *UserData) Type() ObjType {
+	return UserDataObj
+}
+
+func (u *UserData) String() string {
+	if s, ok := u.value.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("<userdata %s>", u.value.Type())
+}
+
+func (u *UserData) Get(name string) (Obj, error) {
+	if m := u.value.MethodByName(name); m.IsValid() {
+		return bindFunc(u.value.Type().String()+"."+name, m)
+	}
+
+	st := u.value
+	if st.Kind() == reflect.Pointer {
+		if st.IsNil() {
+			return nil, fmt.Errorf("nil %s has no property %s", u.value.Type(), name)
+		}
+		st = st.Elem()
+	}
+
+	if f, ok := st.Type().FieldByName(name); ok && f.IsExported() {
+		return FromGo(st.FieldByIndex(f.Index).Interface())
+	}
+
+	return nil, fmt.Errorf("%s has no property %s", u.value.Type(), name)
+}
+
+func (u *UserData) Set(name string, o Obj) error {
+	st := u.value
+	if st.Kind() != reflect.Pointer {
+		return fmt.Errorf("cannot assign to property %s of %s", name, u.value.Type())
+	}
+	if st.IsNil() {
+		return fmt.Errorf("nil %s has no property %s", u.value.Type(), name)
+	}
+	st = st.Elem()
+
+	f, ok := st.Type().FieldByName(name)
+	if !ok || !f.IsExported() {
+		return fmt.Errorf("%s has no property %s", u.value.Type(), name)
+	}
+
+	v, err := toGoValue(o, f.Type)
+	if err != nil {
+		return fmt.Errorf("property %s: %w", name, err)
+	}
+
+	st.FieldByIndex(f.Index).Set(v)
+	return nil
+}
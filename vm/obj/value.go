@@ -0,0 +1,82 @@
+package obj
+
+import "strconv"
+
+// Value is what the VM keeps on its stack and in globals. Numbers are stored
+// inline in num, and booleans and nil refer to shared objects, so none of them
+// allocate. Any other value refers to a heap Obj.
+type Value struct {
+	num float64
+	obj Obj
+}
+
+var NilVal = Value{obj: nilObj}
+
+func NumVal(n float64) Value {
+	return Value{num: n}
+}
+
+func BoolVal(b bool) Value {
+	return Value{obj: NewBool(b)}
+}
+
+// ObjVal wraps o as a Value, unboxing numbers.
+func ObjVal(o Obj) Value {
+	if n, ok := o.(*Number); ok {
+		return Value{num: n.value}
+	}
+	if o == nil {
+		return NilVal
+	}
+
+	return Value{obj: o}
+}
+
+func (v Value) IsNum() bool {
+	return v.obj == nil
+}
+
+func (v Value) AsNum() float64 {
+	return v.num
+}
+
+func (v Value) Type() ObjType {
+	if v.obj == nil {
+		return NumberObj
+	}
+
+	return v.obj.Type()
+}
+
+// Obj returns v as a heap object, boxing numbers.
+func (v Value) Obj() Obj {
+	if v.obj == nil {
+		return NewNumber(v.num)
+	}
+
+	return v.obj
+}
+
+func (v Value) Truthy() bool {
+	if v.obj == nil {
+		return true
+	}
+
+	return Truthy(v.obj)
+}
+
+func (v Value) Equal(w Value) bool {
+	if v.obj == nil || w.obj == nil {
+		return v.obj == w.obj && v.num == w.num
+	}
+
+	return Equal(v.obj, w.obj)
+}
+
+func (v Value) String() string {
+	if v.obj == nil {
+		return strconv.FormatFloat(v.num, 'g', -1, 64)
+	}
+
+	return v.obj.String()
+}
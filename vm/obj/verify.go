@@ -0,0 +1,215 @@
+package obj
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+)
+
+// MaxStack is the most values a function may keep on its part of the VM
+// stack, including the callee and its arguments.
+const MaxStack = math.MaxUint8
+
+// Verify checks that fn and the functions in its constant pool are safe to
+// run: every instruction decodes, every operand indexes a constant, global
+// or local that exists, jumps, handlers and local variable ranges land on
+// instructions, locals are on the stack while they are live, the stack never
+// underflows the frame or grows past MaxStack and has the same height on
+// every path to an instruction, and execution reaches an OpReturn rather
+// than the end of the code.
+func Verify(fn *Function) error {
+	if err := verify(fn); err != nil {
+		return fmt.Errorf("%w: %s", ErrBadBytecode, err)
+	}
+
+	for _, c := range fn.constants {
+		if nested, ok := c.(*Function); ok {
+			if err := Verify(nested); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func verify(fn *Function) error {
+	insts, err := code.Decode(fn.code)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fn, err)
+	}
+
+	if fn.arity+1 > MaxStack {
+		return fmt.Errorf("%s: too many parameters: %d", fn, fn.arity)
+	}
+
+	fail := func(inst code.Instruction, format string, args ...any) error {
+		msg := fmt.Sprintf(format, args...)
+		return fmt.Errorf("%s: offset %d: %s: %s", fn, inst.Offset, code.Name(inst.Op), msg)
+	}
+
+	index := make(map[int]int, len(insts))
+	for i, inst := range insts {
+		index[inst.Offset] = i
+	}
+
+	for _, inst := range insts {
+		switch inst.Op {
+		case code.OpConstant:
+			if inst.Operand >= len(fn.constants) {
+				return fail(inst, "constant %d out of range", inst.Operand)
+			}
+
+		case code.OpGetProperty, code.OpSetProperty, code.OpImport:
+			if inst.Operand >= len(fn.constants) {
+				return fail(inst, "constant %d out of range", inst.Operand)
+			}
+			if fn.constants[inst.Operand].Type() != StringObj {
+				return fail(inst, "operand is a %s", fn.constants[inst.Operand].Type())
+			}
+
+		case code.OpDefineGlobal, code.OpGetGlobal, code.OpSetGlobal:
+			if fn.globals == nil || inst.Operand >= fn.globals.Len() {
+				return fail(inst, "global %d out of range", inst.Operand)
+			}
+
+		case code.OpIterNext, code.OpLoop, code.OpJump:
+			if _, ok := index[inst.Target()]; !ok {
+				return fail(inst, "jump to %d is not an instruction", inst.Target())
+			}
+		}
+	}
+
+	// Follow every path from the entry, recording the stack height before
+	// each instruction. The frame starts with the callee in slot 0 followed
+	// by the arguments.
+	heights := make([]int, len(insts))
+	for i := range heights {
+		heights[i] = -1
+	}
+
+	var work []int
+	enter := func(from code.Instruction, i, height int) error {
+		switch {
+		case i == len(insts):
+			return fmt.Errorf("%s: code does not end in OpReturn", fn)
+		case heights[i] == -1:
+			heights[i] = height
+			work = append(work, i)
+		case heights[i] != height:
+			return fail(from, "stack height %d at %d, was %d", height, insts[i].Offset, heights[i])
+		}
+		return nil
+	}
+
+	if len(insts) == 0 {
+		return fmt.Errorf("%s: code does not end in OpReturn", fn)
+	}
+	heights[0] = fn.arity + 1
+	work = append(work, 0)
+
+	// A handler starts with the error on top of the values it keeps.
+	for i, h := range fn.handlers {
+		_, okStart := index[h.Start]
+		_, okEnd := index[h.End]
+		target, okTarget := index[h.Target]
+		switch {
+		case !okStart || !(okEnd || h.End == len(fn.code)) || h.Start > h.End:
+			return fmt.Errorf("%s: handler %d: invalid range %d-%d", fn, i, h.Start, h.End)
+		case !okTarget:
+			return fmt.Errorf("%s: handler %d: target %d is not an instruction", fn, i, h.Target)
+		case h.Depth < 1 || h.Depth+1 > MaxStack:
+			return fmt.Errorf("%s: handler %d: invalid depth %d", fn, i, h.Depth)
+		}
+
+		if heights[target] == -1 {
+			heights[target] = h.Depth + 1
+			work = append(work, target)
+		} else if heights[target] != h.Depth+1 {
+			return fmt.Errorf("%s: handler %d: stack height %d at %d, was %d", fn, i, h.Depth+1, h.Target, heights[target])
+		}
+	}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		inst, height := insts[i], heights[i]
+
+		pop, push := code.StackEffect(inst.Op, inst.Operand)
+		if height-pop < 1 {
+			return fail(inst, "stack underflow")
+		}
+
+		// Locals are read after the operands are popped and written before
+		// the result is pushed, so they must lie below that point.
+		switch inst.Op {
+		case code.OpGetLocal, code.OpSetLocal:
+			if inst.Operand >= height-pop {
+				return fail(inst, "local %d out of range", inst.Operand)
+			}
+		case code.OpTeeLocal:
+			if inst.Operand >= height-1 {
+				return fail(inst, "local %d out of range", inst.Operand)
+			}
+		case code.OpIterNext:
+			if height < 2 {
+				return fail(inst, "no iterator on the stack")
+			}
+		}
+
+		next := height + push - pop
+		if next > MaxStack {
+			return fail(inst, "stack height exceeds %d", MaxStack)
+		}
+
+		// Unwinding to a handler must not uncover values that were never
+		// pushed.
+		for _, h := range fn.handlers {
+			if h.Start <= inst.Offset && inst.Offset < h.End && height < h.Depth {
+				return fail(inst, "stack height %d below handler depth %d", height, h.Depth)
+			}
+		}
+
+		switch inst.Op {
+		case code.OpReturn, code.OpThrow:
+		case code.OpLoop, code.OpJump:
+			if err := enter(inst, index[inst.Target()], next); err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			// The iterator stays on the stack; the next value is only pushed
+			// when the loop continues.
+			if err := enter(inst, index[inst.Target()], height); err != nil {
+				return err
+			}
+			if err := enter(inst, i+1, next); err != nil {
+				return err
+			}
+		default:
+			if err := enter(inst, i+1, next); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A local must be on the stack wherever it is live.
+	for _, l := range fn.locals {
+		start, okStart := index[l.Start]
+		_, okEnd := index[l.End]
+		switch {
+		case !okStart || !(okEnd || l.End == len(fn.code)) || l.Start > l.End:
+			return fmt.Errorf("%s: local %s: invalid range %d-%d", fn, l.Name, l.Start, l.End)
+		case l.Slot < 1 || l.Slot >= MaxStack:
+			return fmt.Errorf("%s: local %s: invalid slot %d", fn, l.Name, l.Slot)
+		}
+
+		for i := start; i < len(insts) && insts[i].Offset < l.End; i++ {
+			if heights[i] != -1 && heights[i] <= l.Slot {
+				return fmt.Errorf("%s: local %s: slot %d is not on the stack at %d", fn, l.Name, l.Slot, insts[i].Offset)
+			}
+		}
+	}
+
+	return nil
+}
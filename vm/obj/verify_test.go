@@ -0,0 +1,179 @@
+package obj
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+)
+
+func TestVerify(t *testing.T) {
+	op := func(op code.Opcode, operand int) [2]int {
+		return [2]int{int(op), operand}
+	}
+	nils := make([][2]int, MaxStack)
+	for i := range nils {
+		nils[i] = op(code.OpNil, 0)
+	}
+	ret := []byte{code.OpNil, code.OpReturn}
+
+	tests := []struct {
+		name      string
+		arity     int
+		code      []byte
+		constants []Obj
+		handlers  []Handler
+		locals    []LocalInfo
+		err       string
+	}{
+		{
+			name:      "valid",
+			code:      assemble(t, op(code.OpConstant, 0), op(code.OpReturn, 0)),
+			constants: []Obj{NewNumber(1)},
+		},
+		{
+			name: "unknown opcode",
+			code: []byte{0xff},
+			err:  "unknown opcode",
+		},
+		{
+			name:      "constant out of range",
+			code:      assemble(t, op(code.OpConstant, 1), op(code.OpReturn, 0)),
+			constants: []Obj{NewNumber(1)},
+			err:       "constant 1 out of range",
+		},
+		{
+			name:      "property name",
+			code:      assemble(t, op(code.OpNil, 0), op(code.OpGetProperty, 0), op(code.OpReturn, 0)),
+			constants: []Obj{NewNumber(1)},
+			err:       "operand is a number",
+		},
+		{
+			name: "global out of range",
+			code: assemble(t, op(code.OpGetGlobal, 0), op(code.OpReturn, 0)),
+			err:  "global 0 out of range",
+		},
+		{
+			// The jump lands on the operand of OpConstant.
+			name:      "jump into an operand",
+			code:      assemble(t, op(code.OpJump, 1), op(code.OpConstant, 0), op(code.OpReturn, 0)),
+			constants: []Obj{NewNumber(1)},
+			err:       "jump to 4 is not an instruction",
+		},
+		{
+			name: "stack underflow",
+			code: assemble(t, op(code.OpPop, 0), op(code.OpNil, 0), op(code.OpReturn, 0)),
+			err:  "stack underflow",
+		},
+		{
+			name:  "local out of range",
+			arity: 1,
+			code:  assemble(t, op(code.OpGetLocal, 2), op(code.OpReturn, 0)),
+			err:   "local 2 out of range",
+		},
+		{
+			name: "stack overflow",
+			code: assemble(t, append(nils, op(code.OpReturn, 0))...),
+			err:  "stack height exceeds",
+		},
+		{
+			// OpIterNext reaches the return with the iterator alone on the
+			// stack, and the jump with the next value on top of it.
+			name: "mismatched heights",
+			code: assemble(t, op(code.OpNil, 0), op(code.OpIterNext, 3), op(code.OpJump, 0), op(code.OpReturn, 0)),
+			err:  "stack height 3 at 7, was 2",
+		},
+		{
+			name: "missing return",
+			code: assemble(t, op(code.OpNil, 0)),
+			err:  "does not end in OpReturn",
+		},
+		{
+			name: "no code",
+			err:  "does not end in OpReturn",
+		},
+		{
+			name:     "handler range",
+			code:     ret,
+			handlers: []Handler{{Start: 0, End: 9, Target: 1, Depth: 1}},
+			err:      "handler 0: invalid range 0-9",
+		},
+		{
+			name:     "handler target",
+			code:     ret,
+			handlers: []Handler{{Start: 0, End: 1, Target: 5, Depth: 1}},
+			err:      "handler 0: target 5 is not an instruction",
+		},
+		{
+			name:     "handler depth",
+			code:     ret,
+			handlers: []Handler{{Start: 0, End: 1, Target: 1, Depth: 0}},
+			err:      "handler 0: invalid depth 0",
+		},
+		{
+			name:     "handler above the stack",
+			code:     ret,
+			handlers: []Handler{{Start: 0, End: 1, Target: 1, Depth: 2}},
+			err:      "stack height 1 below handler depth 2",
+		},
+		{
+			// The handler reaches the return with the error on the stack,
+			// and the code reaches it with nil.
+			name:     "handler height",
+			code:     assemble(t, op(code.OpNil, 0), op(code.OpPop, 0), op(code.OpReturn, 0)),
+			handlers: []Handler{{Start: 0, End: 1, Target: 2, Depth: 1}},
+			err:      "stack height 1 at 2, was 2",
+		},
+		{
+			name:   "local",
+			arity:  1,
+			code:   ret,
+			locals: []LocalInfo{{Name: "a", Slot: 1, Start: 0, End: 2}},
+		},
+		{
+			name:   "local slot",
+			code:   ret,
+			locals: []LocalInfo{{Name: "a", Slot: 0, Start: 0, End: 2}},
+			err:    "local a: invalid slot 0",
+		},
+		{
+			name:   "local range",
+			code:   ret,
+			locals: []LocalInfo{{Name: "a", Slot: 1, Start: 1, End: 5}},
+			err:    "local a: invalid range 1-5",
+		},
+		{
+			// Slot 1 only holds a value once OpNil has run.
+			name:   "local not on the stack",
+			code:   ret,
+			locals: []LocalInfo{{Name: "a", Slot: 1, Start: 0, End: 2}},
+			err:    "local a: slot 1 is not on the stack at 0",
+		},
+		{
+			name:      "nested function",
+			code:      ret,
+			constants: []Obj{NewFunction("inner", 0, []byte{code.OpPop, code.OpReturn}, nil, nil, nil)},
+			err:       "<fn inner>: offset 0: OpPop: stack underflow",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := NewFunction("f", tt.arity, tt.code, tt.constants, nil, nil)
+			fn.SetHandlers(tt.handlers)
+			fn.SetLocals(tt.locals)
+
+			err := Verify(fn)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrBadBytecode) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"math"
+	"sort"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// peephole rewrites common instruction sequences in c.code:
+//
+//	OpSetLocal i, OpGetLocal i  =>  OpTeeLocal i
+//	OpConstant k, OpPop         =>  (nothing)
+//	OpPop, OpPop, ...           =>  OpPopN n
+//	OpConstant k, OpNegate      =>  OpConstant -k
+//
+// Merged instructions keep the line of the first one, and the line table,
+// local variable ranges, handlers and jumps are moved to the new offsets. An
+// instruction that is the target of a jump or starts or ends a handler's
+// range is never merged into the one before it.
+func (c *Compiler) peephole() error {
+	insts, err := code.Decode(c.code)
+	if err != nil {
+		return err
+	}
+
+	type instruction struct {
+		code.Instruction
+		line int
+	}
+
+	targets := make(map[int]bool)
+	for _, inst := range insts {
+		if code.IsJump(inst.Op) {
+			targets[inst.Target()] = true
+		}
+	}
+	for _, h := range c.handlers {
+		targets[h.Start], targets[h.End], targets[h.Target] = true, true, true
+	}
+
+	var out []instruction
+	last := func() *instruction {
+		if len(out) == 0 {
+			return nil
+		}
+		return &out[len(out)-1]
+	}
+
+	for _, ins := range insts {
+		inst := instruction{Instruction: ins, line: c.lines.Line(ins.Offset)}
+		prev := last()
+
+		switch {
+		case prev == nil, targets[inst.Offset], code.IsJump(prev.Op):
+
+		case inst.Op == code.OpGetLocal && prev.Op == code.OpSetLocal && prev.Operand == inst.Operand:
+			prev.Op = code.OpTeeLocal
+			continue
+
+		case inst.Op == code.OpPop && isPush(prev.Op):
+			out = out[:len(out)-1]
+			continue
+
+		case inst.Op == code.OpPop && prev.Op == code.OpPop:
+			prev.Op, prev.Operand = code.OpPopN, 2
+			continue
+
+		case inst.Op == code.OpPop && prev.Op == code.OpPopN && prev.Operand < math.MaxUint8:
+			prev.Operand += 1
+			continue
+
+		case inst.Op == code.OpNegate && prev.Op == code.OpConstant:
+			k := c.constants[prev.Operand]
+			if k.Type() != obj.NumberObj {
+				break
+			}
+
+			idx, err := c.addConstant(obj.NewNumber(-obj.AsNum(k)))
+			if err != nil {
+				return err
+			}
+			prev.Operand = idx
+			continue
+		}
+
+		out = append(out, inst)
+	}
+
+	oldCode := c.code
+	offsets := make([]int, len(out))
+
+	c.code, c.lines = nil, nil
+	for i, inst := range out {
+		offsets[i] = len(c.code)
+		c.line = inst.line
+
+		switch {
+		case code.IsJump(inst.Op):
+			c.emitJump(inst.Op)
+		case code.IsIndex(inst.Op):
+			c.emitIndexInst(inst.Op, inst.Operand)
+		case code.OperandWidth(inst.Op) > 0:
+			c.emitInsts(inst.Op, byte(inst.Operand))
+		default:
+			c.emit(inst.Op)
+		}
+	}
+
+	// An old offset moves to the first instruction kept at or after it.
+	relocate := func(offset int) int {
+		i := sort.Search(len(out), func(i int) bool { return out[i].Offset >= offset })
+		if i == len(out) || offset >= len(oldCode) {
+			return len(c.code)
+		}
+		return offsets[i]
+	}
+	for i, l := range c.debugLocals {
+		c.debugLocals[i].Start, c.debugLocals[i].End = relocate(l.Start), relocate(l.End)
+	}
+	for i, h := range c.handlers {
+		c.handlers[i].Start, c.handlers[i].End, c.handlers[i].Target = relocate(h.Start), relocate(h.End), relocate(h.Target)
+	}
+	for i, inst := range out {
+		if code.IsJump(inst.Op) {
+			if err := c.patchJump(offsets[i], relocate(inst.Target())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isPush reports whether op only pushes a value, so that it can be dropped
+// together with a following OpPop.
+func isPush(op code.Opcode) bool {
+	switch op {
+	case code.OpConstant, code.OpNil, code.OpTrue, code.OpFalse, code.OpGetLocal:
+		return true
+	default:
+		return false
+	}
+}
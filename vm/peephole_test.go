@@ -0,0 +1,174 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// TestPeepholeOutput evaluates each script with and without the peephole
+// pass and compares the results, or the runtime errors.
+func TestPeepholeOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+
+		// merged lists instructions the pass should produce.
+		merged []code.Opcode
+	}{
+		{
+			name: "tee local",
+			src: `function f(a) {
+  let b = 0
+  b = a
+  return b + b
+}
+f(2)
+`,
+			merged: []code.Opcode{code.OpTeeLocal},
+		},
+		{
+			name: "error after tee local",
+			src: `function f(a) {
+  let b = 0
+  b = a
+  return b + nil
+}
+f(1)
+`,
+			merged: []code.Opcode{code.OpTeeLocal},
+		},
+		{
+			name: "pop block locals",
+			src: `function f() {
+  let r = 0
+  {
+    let c = 1
+    let d = 2
+    let e = 3
+    r = c + d + e
+  }
+  return r
+}
+f()
+`,
+			merged: []code.Opcode{code.OpPopN},
+		},
+		{
+			name: "unused constants",
+			src: `function f() {
+  1
+  "unused"
+  return 2
+}
+f()
+`,
+		},
+		{
+			name: "negated constants",
+			src: `function f(a) {
+  return -2 * a - -a
+}
+f(3)
+`,
+		},
+		{
+			name: "loop body",
+			src: `function f(n) {
+  let total = 0
+  for i in range(0, n, 1) {
+    let a = i
+    let b = a * 2
+    total = total + b
+    total = total + a
+  }
+  return total
+}
+f(4)
+`,
+			merged: []code.Opcode{code.OpPopN, code.OpTeeLocal},
+		},
+		{
+			name: "handler",
+			src: `function f(n) {
+  let w = 0
+  w = n
+  w = w + n
+  w = w + n
+  w = w + n
+  try {
+    throw w
+  } catch (e) {
+    return e + nil
+  }
+}
+function g(n) {
+  try {
+    f(n)
+  } catch (e) {
+    return e
+  }
+}
+g(1)
+`,
+			merged: []code.Opcode{code.OpPopN, code.OpTeeLocal},
+		},
+	}
+
+	eval := func(t *testing.T, src string, opts Options) string {
+		t.Helper()
+
+		machine := Init(false)
+		machine.SetOptions(opts)
+		res, err := machine.Eval([]byte(src))
+		if err != nil {
+			return err.Error()
+		}
+		return res.String()
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := eval(t, tt.src, Options{NoPeephole: true})
+			got := eval(t, tt.src, Options{})
+			if got != want {
+				t.Errorf("with peephole: %s, without: %s", got, want)
+			}
+
+			fn, err := CompileSource([]byte(tt.src), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops := make(map[code.Opcode]bool)
+			if err := opcodes(fn, ops); err != nil {
+				t.Fatal(err)
+			}
+			for _, op := range tt.merged {
+				if !ops[op] {
+					t.Errorf("no %s in the optimized bytecode", code.Name(op))
+				}
+			}
+		})
+	}
+}
+
+// opcodes adds the opcodes of fn and the functions nested in it to ops.
+func opcodes(fn *obj.Function, ops map[code.Opcode]bool) error {
+	insts, err := obj.Disassemble(fn)
+	if err != nil {
+		return err
+	}
+	for _, inst := range insts {
+		ops[inst.Opcode] = true
+	}
+
+	for _, k := range fn.Constants() {
+		if nested, ok := k.(*obj.Function); ok {
+			if err := opcodes(nested, ops); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// Field numbers from the pprof profile.proto schema.
+const (
+	pprofSampleType    = 1
+	pprofSample        = 2
+	pprofLocation      = 4
+	pprofFunction      = 5
+	pprofStringTable   = 6
+	pprofTimeNanos     = 9
+	pprofDurationNanos = 10
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocation = 1
+	pprofSampleValue    = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunction = 1
+	pprofLineLine     = 2
+
+	pprofFunctionID        = 1
+	pprofFunctionName      = 2
+	pprofFunctionFilename  = 4
+	pprofFunctionStartLine = 5
+)
+
+// WritePprof writes the profile as a gzipped pprof protocol buffer that can
+// be read by go tool pprof. Each sample is a script call stack with the
+// number of calls and the self time of the function on top.
+func (p *Profile) WritePprof(w io.Writer) error {
+	var enc pprofEncoder
+	enc.strings = map[string]int{"": 0}
+	enc.stringTable = []string{""}
+
+	enc.valueType(pprofSampleType, "calls", "count")
+	enc.valueType(pprofSampleType, "time", "nanoseconds")
+
+	functions := make(map[obj.Obj]uint64)
+	locations := make(map[SourceLine]uint64)
+	file := enc.str(p.File)
+
+	for _, s := range p.samples {
+		var ids []uint64
+		for _, loc := range s.stack {
+			fnID, ok := functions[loc.Function]
+			if !ok {
+				fnID = uint64(len(functions) + 1)
+				functions[loc.Function] = fnID
+
+				var fn protoBuf
+				fn.uint(pprofFunctionID, fnID)
+				fn.uint(pprofFunctionName, uint64(enc.str(functionName(loc.Function))))
+				fn.uint(pprofFunctionFilename, uint64(file))
+				fn.uint(pprofFunctionStartLine, uint64(firstLine(loc.Function)))
+				enc.body.bytes(pprofFunction, fn)
+			}
+
+			id, ok := locations[loc]
+			if !ok {
+				id = uint64(len(locations) + 1)
+				locations[loc] = id
+
+				var line protoBuf
+				line.uint(pprofLineFunction, fnID)
+				line.uint(pprofLineLine, uint64(loc.Line))
+
+				var l protoBuf
+				l.uint(pprofLocationID, id)
+				l.bytes(pprofLocationLine, line)
+				enc.body.bytes(pprofLocation, l)
+			}
+
+			ids = append(ids, id)
+		}
+
+		var sm protoBuf
+		sm.packed(pprofSampleLocation, ids)
+		sm.packed(pprofSampleValue, []uint64{s.calls, uint64(s.self)})
+		enc.body.bytes(pprofSample, sm)
+	}
+
+	end := p.end
+	if end.IsZero() || end.Before(p.start) {
+		end = p.start
+	}
+	if !p.start.IsZero() {
+		enc.body.uint(pprofTimeNanos, uint64(p.start.UnixNano()))
+		enc.body.uint(pprofDurationNanos, uint64(end.Sub(p.start)))
+	}
+
+	for _, s := range enc.stringTable {
+		enc.body.bytes(pprofStringTable, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(enc.body); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type pprofEncoder struct {
+	body        protoBuf
+	strings     map[string]int
+	stringTable []string
+}
+
+// str returns the index of s in the string table, adding it if needed.
+func (e *pprofEncoder) str(s string) int {
+	if i, ok := e.strings[s]; ok {
+		return i
+	}
+
+	i := len(e.stringTable)
+	e.strings[s] = i
+	e.stringTable = append(e.stringTable, s)
+	return i
+}
+
+func (e *pprofEncoder) valueType(field int, typ, unit string) {
+	var vt protoBuf
+	vt.uint(pprofValueTypeType, uint64(e.str(typ)))
+	vt.uint(pprofValueTypeUnit, uint64(e.str(unit)))
+	e.body.bytes(field, vt)
+}
+
+// protoBuf is an encoded protocol buffer message. Only the varint and
+// length-delimited wire types are needed.
+type protoBuf []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuf) key(field, wire int) {
+	*b = binary.AppendUvarint(*b, uint64(field)<<3|uint64(wire))
+}
+
+func (b *protoBuf) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *protoBuf) bytes(field int, v []byte) {
+	b.key(field, wireBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protoBuf) packed(field int, vs []uint64) {
+	var p []byte
+	for _, v := range vs {
+		p = binary.AppendUvarint(p, min(v, math.MaxInt64))
+	}
+	b.bytes(field, p)
+}
@@ -0,0 +1,264 @@
+package vm
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sushil-cmd-r/glox/vm/code"
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// Profile collects execution statistics while it is attached to a VM with
+// SetProfile.
+type Profile struct {
+	// File names the script in exported profiles.
+	File string
+
+	// Opcodes counts executed instructions by opcode.
+	Opcodes [len(code.Opcodes)]uint64
+
+	// Functions holds call counts and times for each script and native
+	// function that was called.
+	Functions map[obj.Obj]*FunctionProfile
+
+	// Lines counts how many times execution entered each source line.
+	Lines map[SourceLine]uint64
+
+	samples map[string]*sample
+	start   time.Time
+	end     time.Time
+}
+
+// FunctionProfile is the profile of a single function. Total includes the
+// time spent in functions it called and Self does not.
+type FunctionProfile struct {
+	Name  string
+	Line  int
+	Calls uint64
+	Total time.Duration
+	Self  time.Duration
+}
+
+type SourceLine struct {
+	Function obj.Obj
+	Line     int
+}
+
+// sample is the self time spent in the function at the top of a call stack.
+type sample struct {
+	stack []SourceLine
+	calls uint64
+	self  time.Duration
+}
+
+func NewProfile() *Profile {
+	return &Profile{
+		Functions: make(map[obj.Obj]*FunctionProfile),
+		Lines:     make(map[SourceLine]uint64),
+		samples:   make(map[string]*sample),
+	}
+}
+
+// SetProfile attaches p to vm so that code it runs is profiled. A nil p stops
+// profiling.
+func (vm *VM) SetProfile(p *Profile) {
+	now := time.Now()
+	if vm.profile != nil {
+		vm.profile.end = now
+	}
+	if p != nil && p.start.IsZero() {
+		p.start = now
+	}
+
+	vm.profile = p
+	vm.instrument()
+}
+
+func (vm *VM) Profile() *Profile {
+	return vm.profile
+}
+
+// step records the execution of op, which was just read from the current
+// frame, in the attached profile and coverage, gives the debugger a chance to
+// stop before it runs and reports it to the instruction hook and tracer. An
+// OpWide prefix is not stepped on its own but as part of the opcode after it.
+func (vm *VM) step(op code.Opcode) error {
+	frame := vm.currFrame
+	if vm.profile != nil && int(op) < len(vm.profile.Opcodes) {
+		vm.profile.Opcodes[op] += 1
+	}
+
+	// A line is entered when execution moves to it, or when a loop jumps
+	// back to code of the line that already ran since it was entered, so a
+	// loop written on one line counts once per iteration.
+	offset := vm.instOffset(frame)
+	line := frame.function.Line(offset)
+	entered := line != frame.line || frame.looped && frame.lineStart <= offset
+	frame.looped = op == code.OpLoop
+	if entered {
+		frame.line, frame.lineStart = line, offset
+
+		if vm.profile != nil {
+			vm.profile.Lines[SourceLine{Function: frame.function, Line: line}] += 1
+		}
+		if vm.coverage != nil {
+			vm.coverage.hit(frame.function, line)
+		}
+	}
+
+	if vm.debugger != nil {
+		if err := vm.debugger.check(frame, line, entered); err != nil {
+			return err
+		}
+	}
+
+	if vm.hooks.instruction != nil {
+		vm.hooks.instruction(vm.frameInfo(frame), op, vm.stack[:vm.sp])
+	}
+	if vm.tracer != nil {
+		vm.tracer.trace(frame, offset, vm.stack[:vm.sp])
+	}
+	return nil
+}
+
+// profileReturn records the call of the current frame, which is returning.
+func (vm *VM) profileReturn() {
+	frame := vm.currFrame
+	elapsed := time.Since(frame.start)
+	if vm.fp > 0 {
+		vm.frames[vm.fp-1].child += elapsed
+	}
+
+	vm.profile.record(frame.function, vm.profileStack(frame.function, vm.fp-1), elapsed, elapsed-frame.child)
+}
+
+// profileNative records a call to a native function made from the current
+// frame.
+func (vm *VM) profileNative(fn *obj.NativeFn, elapsed time.Duration) {
+	if vm.fp >= 0 {
+		vm.frames[vm.fp].child += elapsed
+	}
+
+	vm.profile.record(fn, vm.profileStack(fn, vm.fp), elapsed, elapsed)
+}
+
+// profileStack returns the stack of a call to fn made from frames[top], with
+// fn first.
+func (vm *VM) profileStack(fn obj.Obj, top int) []SourceLine {
+	stack := []SourceLine{{Function: fn, Line: firstLine(fn)}}
+	for i := top; i >= 0; i-- {
+		frame := vm.frames[i]
+		stack = append(stack, SourceLine{Function: frame.function, Line: frame.function.Line(frame.ip - 1)})
+	}
+
+	return stack
+}
+
+func (p *Profile) record(fn obj.Obj, stack []SourceLine, total, self time.Duration) {
+	fp, ok := p.Functions[fn]
+	if !ok {
+		fp = &FunctionProfile{Name: functionName(fn), Line: firstLine(fn)}
+		p.Functions[fn] = fp
+	}
+	fp.Calls += 1
+	fp.Total += total
+	fp.Self += self
+
+	var key strings.Builder
+	for _, loc := range stack {
+		fmt.Fprintf(&key, "%p:%d;", loc.Function, loc.Line)
+	}
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &sample{stack: stack}
+		p.samples[key.String()] = s
+	}
+	s.calls += 1
+	s.self += self
+}
+
+// WriteText writes a report of the profile sorted by opcode count, self time
+// and line hits.
+func (p *Profile) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	type opcount struct {
+		op    code.Opcode
+		count uint64
+	}
+	var ops []opcount
+	var total uint64
+	for op, n := range p.Opcodes {
+		if n > 0 {
+			ops = append(ops, opcount{code.Opcode(op), n})
+			total += n
+		}
+	}
+	slices.SortStableFunc(ops, func(a, b opcount) int { return cmp.Compare(b.count, a.count) })
+
+	fmt.Fprintf(&b, "instructions: %d\n\n", total)
+	fmt.Fprintf(&b, "%12s %7s  %s\n", "count", "%", "opcode")
+	for _, o := range ops {
+		fmt.Fprintf(&b, "%12d %6.2f%%  %s\n", o.count, 100*float64(o.count)/float64(total), code.Name(o.op))
+	}
+
+	fns := make([]*FunctionProfile, 0, len(p.Functions))
+	for _, fp := range p.Functions {
+		fns = append(fns, fp)
+	}
+	slices.SortFunc(fns, func(a, b *FunctionProfile) int {
+		return cmp.Or(cmp.Compare(b.Self, a.Self), cmp.Compare(a.Name, b.Name))
+	})
+
+	fmt.Fprintf(&b, "\n%12s %14s %14s  %s\n", "calls", "total", "self", "function")
+	for _, fp := range fns {
+		fmt.Fprintf(&b, "%12d %14s %14s  %s\n", fp.Calls, fp.Total, fp.Self, fp.Name)
+	}
+
+	type linecount struct {
+		name  string
+		line  int
+		count uint64
+	}
+	var lines []linecount
+	for l, n := range p.Lines {
+		lines = append(lines, linecount{functionName(l.Function), l.Line, n})
+	}
+	slices.SortFunc(lines, func(a, b linecount) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), cmp.Compare(a.name, b.name), cmp.Compare(a.line, b.line))
+	})
+
+	fmt.Fprintf(&b, "\n%12s  %s\n", "hits", "line")
+	for _, l := range lines {
+		fmt.Fprintf(&b, "%12d  %s:%d\n", l.count, l.name, l.line)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func functionName(fn obj.Obj) string {
+	switch fn := fn.(type) {
+	case *obj.Function:
+		if fn.Name() == InitFunc {
+			return "script"
+		}
+		return fn.Name()
+	case *obj.NativeFn:
+		return fn.Name()
+	default:
+		return fn.String()
+	}
+}
+
+func firstLine(fn obj.Obj) int {
+	if fn, ok := fn.(*obj.Function); ok && len(fn.Lines()) > 0 {
+		return fn.Lines()[0].Line
+	}
+	return 0
+}
@@ -0,0 +1,35 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProfileLoopLines(t *testing.T) {
+	for _, tt := range loopLineTests {
+		for _, opts := range []Options{{}, {NoPeephole: true}} {
+			t.Run(fmt.Sprintf("%s %+v", tt.name, opts), func(t *testing.T) {
+				machine := Init(false)
+				machine.SetOutput(&strings.Builder{})
+				machine.SetOptions(opts)
+				profile := NewProfile()
+				machine.SetProfile(profile)
+
+				if err := machine.ExecuteFile("loop.glox", []byte(tt.src)); err != nil {
+					t.Fatal(err)
+				}
+
+				got := make(map[int]uint64)
+				for l, n := range profile.Lines {
+					got[l.Line] += n
+				}
+				for line, want := range tt.want {
+					if got[line] != want {
+						t.Errorf("line %d: got %d hits, want %d", line, got[line], want)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package vm
+
+import "github.com/sushil-cmd-r/glox/vm/obj"
+
+// Program is a compiled script that can be run by any number of VMs, including
+// concurrently from different goroutines. Its global names are resolved
+// against a table of its own, which each VM running it maps onto its globals
+// by name, so every VM keeps its own globals, stack and frames.
+type Program struct {
+	function *obj.Function
+}
+
+// Compile parses and compiles src into a Program with the default options.
+func Compile(src []byte) (*Program, error) {
+	return CompileProgram("", src, Options{})
+}
+
+// CompileProgram compiles src, read from file, into a Program.
+// Options.Debug is ignored; tracing is set on the VM that runs it.
+func CompileProgram(file string, src []byte, opts Options) (*Program, error) {
+	function, err := compileSource(src, obj.NewGlobals(), false, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	function.SetFile(file)
+	return &Program{function: function}, nil
+}
+
+// LoadProgram decodes a compiled script produced by obj.Marshal into a
+// Program.
+func LoadProgram(data []byte) (*Program, error) {
+	function, err := obj.Unmarshal(data, obj.NewGlobals())
+	if err != nil {
+		return nil, &Error{Kind: CompileError, Err: err}
+	}
+
+	return &Program{function: function}, nil
+}
+
+// Function returns the top-level script function of p, for disassembly or
+// marshalling. It is shared by every VM running p and must not be modified.
+func (p *Program) Function() *obj.Function {
+	return p.function
+}
+
+// File returns the name of the file p was compiled from.
+func (p *Program) File() string {
+	return p.function.File()
+}
+
+// RunProgram executes p with the globals of vm.
+func (vm *VM) RunProgram(p *Program) error {
+	_, err := vm.exec(p.function)
+	return err
+}
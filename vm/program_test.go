@@ -0,0 +1,57 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+// TestProgramConcurrent runs one Program on many VMs at once, each with its
+// own value of n. Run it with -race.
+func TestProgramConcurrent(t *testing.T) {
+	src := `let total = 0
+
+function add(a) {
+  total = total + a
+  return total
+}
+
+add(n)
+add(n * 2)
+print n
+print add(1)
+`
+	p, err := CompileProgram("concurrent.glox", []byte(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 16
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for run := range 5 {
+				n := w*5 + run
+				var out strings.Builder
+				machine := Init(false)
+				machine.SetOutput(&out)
+				machine.SetGlobal("n", obj.NewNumber(float64(n)))
+				if err := machine.RunProgram(p); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if want := fmt.Sprintf("%d\n%d\n", n, n*3+1); out.String() != want {
+					t.Errorf("n = %d: got %q, want %q", n, out.String(), want)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,231 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sushil-cmd-r/glox/vm/obj"
+)
+
+func TestTry(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		err  string
+	}{
+		{
+			name: "throw string",
+			src: `try {
+  throw "boom"
+} catch (e) {
+  print e
+  print e.message
+}
+`,
+			want: "error: boom\nboom\n",
+		},
+		{
+			name: "throw non-error value",
+			src: `try {
+  throw 42
+} catch (e) {
+  print e.value + 1
+  print e.message
+}
+`,
+			want: "43\n42\n",
+		},
+		{
+			name: "division by zero",
+			src: `let zero = 0
+try {
+  print 1 / zero
+} catch (e) {
+  print e
+}
+`,
+			want: "error: division by zero\n",
+		},
+		{
+			name: "undefined variable",
+			src: `try {
+  print missing
+} catch (e) {
+  print "caught"
+}
+`,
+			want: "caught\n",
+		},
+		{
+			name: "rethrow",
+			src: `function f() { throw "inner"; }
+try {
+  try {
+    f()
+  } catch (e) {
+    print "first"
+    throw e
+  }
+} catch (e) {
+  print e
+  print e.stack
+}
+`,
+			want: "first\nerror: inner\n[f (line 1), script (line 4)]\n",
+		},
+		{
+			name: "nested try",
+			src: `try {
+  try {
+    throw "a"
+  } catch (e) {
+    print e
+  }
+  throw "b"
+} catch (e) {
+  print e
+}
+`,
+			want: "error: a\nerror: b\n",
+		},
+		{
+			name: "throw from catch runs finally",
+			src: `try {
+  try {
+    throw "a"
+  } catch (e) {
+    throw "b"
+  } finally {
+    print "finally"
+  }
+} catch (e) {
+  print e
+}
+`,
+			want: "finally\nerror: b\n",
+		},
+		{
+			name: "finally on return",
+			src: `function f() {
+  try {
+    return 1
+  } finally {
+    print "finally"
+  }
+}
+print f()
+`,
+			want: "finally\n1\n",
+		},
+		{
+			name: "finally across frames",
+			src: `function h() { throw "deep"; }
+function g() {
+  try {
+    return h()
+  } finally {
+    print "g"
+  }
+}
+function f() {
+  try {
+    return g()
+  } finally {
+    print "f"
+  }
+}
+try {
+  f()
+} catch (e) {
+  print e
+}
+`,
+			want: "g\nf\nerror: deep\n",
+		},
+		{
+			name: "uncaught through finally",
+			src: `try {
+  throw "boom"
+} finally {
+  print "finally"
+}
+`,
+			want: "finally\n",
+			err:  "boom",
+		},
+		{
+			name: "uncaught",
+			src:  "throw \"boom\"\n",
+			err:  "boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, opts := range []Options{{}, {NoFold: true, NoPeephole: true}} {
+				var out strings.Builder
+				machine := Init(false)
+				machine.SetOptions(opts)
+				machine.SetOutput(&out)
+
+				err := machine.Execute([]byte(tt.src))
+				if tt.err != "" {
+					var e *obj.Error
+					if !errors.As(err, &e) || e.Message() != tt.err {
+						t.Errorf("%+v: got error %v, want %q", opts, err, tt.err)
+					}
+				} else if err != nil {
+					t.Fatalf("%+v: %v", opts, err)
+				}
+
+				if got := out.String(); got != tt.want {
+					t.Errorf("%+v: got %q, want %q", opts, got, tt.want)
+				}
+				if machine.sp != 0 || machine.fp != -1 {
+					t.Errorf("%+v: sp = %d, fp = %d after the script", opts, machine.sp, machine.fp)
+				}
+			}
+		})
+	}
+}
+
+// TestTryStackDepth checks that unwinding drops the values an expression left
+// on the stack, so that a handler sees only the locals live at the try
+// statement and the error.
+func TestTryStackDepth(t *testing.T) {
+	src := `function g() { throw "boom"; }
+function f(a) {
+  let b = a * 2
+  let d = depth()
+  try {
+    let c = 1
+    return 1 + (2 * (b + g()))
+  } catch (e) {
+    print depth() - d
+    return a + b
+  }
+}
+print f(1)
+print f(2)
+`
+	var out strings.Builder
+	machine := Init(false)
+	machine.SetOutput(&out)
+	if err := machine.Bind("depth", func() int { return machine.sp }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := machine.Execute([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	// Above the stack at the first call to depth are only d and the catch
+	// variable.
+	if want := "2\n3\n2\n6\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	if machine.sp != 0 {
+		t.Errorf("sp = %d after the script", machine.sp)
+	}
+}
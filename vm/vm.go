@@ -2,7 +2,10 @@ package vm
 
 import (
 	"fmt"
-	"math"
+	"io"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/sushil-cmd-r/glox/ast"
 	"github.com/sushil-cmd-r/glox/parser"
@@ -14,60 +17,346 @@ const InitFunc = "<init>"
 type CalLFrame struct {
 	function *obj.Function
 	ip       int
-	stack    []obj.Obj
+	base     int
+	stack    []obj.Value
+
+	// table holds the globals of function: those of the VM, or of the
+	// module that defined it. globals maps the slots used by function to
+	// those of table, or is nil when function was compiled against it.
+	table   *obj.Globals
+	globals []int
+
+	// Profiling state: when the call started and the time spent in calls
+	// made from it. line is the last source line executed, tracked while
+	// profiling, recording coverage or debugging, and lineStart the offset
+	// where it was entered. looped is set after an OpLoop.
+	start     time.Time
+	child     time.Duration
+	line      int
+	lineStart int
+	looped    bool
 }
 
 type VM struct {
-	fp        int
-	frames    [64]*CalLFrame
-	currFrame *CalLFrame
+	// context holds the call frames and value stack of the running fiber,
+	// which is the coroutine in fiber or the main one when that is nil.
+	context
+	fiber *Fiber
+
+	globals *obj.Globals
+	opts    Options
+
+	// slotMaps caches the mapping from the global slots of programs compiled
+	// elsewhere to those of globals.
+	slotMaps map[*obj.Globals][]int
+
+	modules    modules
+	importPath []string
+
+	out     io.Writer
+	profile *Profile
+
+	// outMu serialises output from VMs started with spawn, which share out.
+	outMu *sync.Mutex
+
+	coverage  *Coverage
+	coverFile string
+
+	debugger *Debugger
+
+	hooks  hooks
+	tracer *tracer
+
+	// instrumented is set when instructions have to be reported to any of
+	// the above.
+	instrumented bool
+
+	// wide is set by OpWide so the next constant operand is read as two bytes.
+	wide bool
+}
 
-	sp    int
-	stack [64 * math.MaxUint8]obj.Obj
+// Options control how source is compiled.
+type Options struct {
+	// Debug traces every instruction as it runs, with the stack before it,
+	// to the VM output.
+	Debug bool
 
-	globals map[string]obj.Obj
-	debug   bool
+	// NoFold disables evaluating operations on literals at compile time.
+	NoFold bool
+
+	// NoPeephole disables rewriting common instruction sequences after a
+	// function is compiled.
+	NoPeephole bool
 }
 
 func Init(debug bool) *VM {
-	vm := &VM{fp: -1, globals: make(map[string]obj.Obj), debug: debug}
+	vm := &VM{context: newContext(), globals: obj.NewGlobals(), out: os.Stdout, outMu: new(sync.Mutex)}
+	vm.defineBuiltins()
+	vm.SetDebug(debug)
 	return vm
 }
 
+// SetOutput sets where print statements and Debug traces write to. It
+// defaults to stdout.
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.out = w
+	if vm.opts.Debug {
+		vm.Trace(w)
+	}
+}
+
+func (vm *VM) SetOptions(opts Options) {
+	vm.opts = opts
+	vm.SetDebug(opts.Debug)
+}
+
+func (vm *VM) Options() Options {
+	return vm.opts
+}
+
+func (vm *VM) SetDebug(debug bool) {
+	if debug {
+		vm.Trace(vm.out)
+	} else if vm.opts.Debug {
+		vm.Trace(nil)
+	}
+	vm.opts.Debug = debug
+}
+
+func (vm *VM) Debug() bool {
+	return vm.opts.Debug
+}
+
 func (vm *VM) Execute(src []byte) error {
+	function, err := compileSource(src, vm.globals, false, vm.opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = vm.exec(function)
+	return err
+}
+
+// ExecuteFile runs src like Execute, recording file as the source of its
+// functions so that debugger breakpoints can refer to it.
+func (vm *VM) ExecuteFile(file string, src []byte) error {
+	function, err := vm.CompileFile(file, src)
+	if err != nil {
+		return err
+	}
+
+	_, err = vm.exec(function)
+	return err
+}
+
+// CompileFile compiles src, read from file, against the globals of vm so that
+// it can be passed to Run.
+func (vm *VM) CompileFile(file string, src []byte) (*obj.Function, error) {
+	function, err := compileSource(src, vm.globals, false, vm.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	function.SetFile(file)
+	return function, nil
+}
+
+// Eval runs src like Execute and returns the value of its last statement when
+// that statement is an expression, or nil otherwise.
+func (vm *VM) Eval(src []byte) (obj.Obj, error) {
+	function, err := vm.CompileEval(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.RunEval(function)
+}
+
+// CompileEval compiles src as Eval would, without running it, so that it can
+// be passed to RunEval.
+func (vm *VM) CompileEval(src []byte) (*obj.Function, error) {
+	return compileSource(src, vm.globals, true, vm.opts)
+}
+
+// RunEval executes a script function returned by CompileEval and returns the
+// value of its last statement.
+func (vm *VM) RunEval(function *obj.Function) (obj.Obj, error) {
+	return vm.exec(function)
+}
+
+// CompileSource parses and compiles src into its top-level script function
+// without running it.
+func CompileSource(src []byte, opts Options) (*obj.Function, error) {
+	return compileSource(src, obj.NewGlobals(), false, opts)
+}
+
+// Load decodes a compiled script produced by obj.Marshal so that it can be
+// passed to Run. Its globals are bound to those of vm.
+func (vm *VM) Load(data []byte) (*obj.Function, error) {
+	function, err := obj.Unmarshal(data, vm.globals)
+	if err != nil {
+		return nil, &Error{Kind: CompileError, Err: err}
+	}
+
+	return function, nil
+}
+
+// Run executes a script function returned by Load, CompileFile or
+// CompileSource. Globals it refers to are looked up in vm by name.
+func (vm *VM) Run(function *obj.Function) error {
+	_, err := vm.exec(function)
+	return err
+}
+
+func compileSource(src []byte, globals *obj.Globals, eval bool, opts Options) (*obj.Function, error) {
 	p := parser.New(src)
 	prog, err := p.Parse()
 	if err != nil {
-		return fmt.Errorf("Syntax Error: %w", err)
+		return nil, &Error{Kind: SyntaxError, Err: err}
+	}
+
+	if ret := topLevelReturn(prog); ret != nil {
+		return nil, &Error{Kind: CompileError, Err: fmt.Errorf("line %d: %w", ret.Line, ErrTopLevelReturn)}
+	}
+
+	if n := len(prog); eval && n > 0 {
+		if stmt, ok := prog[n-1].(*ast.ExprStmt); ok {
+			prog[n-1] = &ast.ReturnStmt{Value: stmt.Expression}
+		}
+	}
+
+	if !opts.NoFold {
+		foldStmts(prog)
 	}
 
 	fnExpr := &ast.FuncExpr{Params: nil, Body: &ast.BlockStmt{Stmts: prog}}
-	function, err := Compile(fnExpr, InitFunc, vm.debug)
+	function, err := compileFunction(fnExpr, InitFunc, globals, opts)
 	if err != nil {
-		return fmt.Errorf("Compilation Error: %w", err)
+		return nil, &Error{Kind: CompileError, Err: err}
 	}
 
-	vm.push(function)
-	vm.call(function, 0)
-	// return nil
-	return vm.run()
+	return function, nil
 }
 
-func (vm *VM) call(o obj.Obj, args byte) error {
-	if o.Type() != obj.FuncObj {
-		return fmt.Errorf("%s not callable", o.Type())
+func (vm *VM) exec(function *obj.Function) (obj.Obj, error) {
+	if vm.coverage != nil {
+		vm.coverage.add(vm.coverFile, function)
 	}
 
-	fn := o.(*obj.Function)
-	frame := &CalLFrame{
+	res, err := vm.Call(function)
+	if err != nil {
+		return nil, &Error{Kind: RuntimeError, Err: err}
+	}
+
+	return res, nil
+}
+
+// globalSlots returns the slots in vm of the globals in g, or nil if g is the
+// VM's own table.
+func (vm *VM) globalSlots(g *obj.Globals) []int {
+	if g == vm.globals || g == nil {
+		return nil
+	}
+
+	if vm.slotMaps == nil {
+		vm.slotMaps = make(map[*obj.Globals][]int)
+	}
+
+	slots := vm.slotMaps[g]
+	for i := len(slots); i < g.Len(); i++ {
+		slots = append(slots, vm.globals.Slot(g.Name(i)))
+	}
+	vm.slotMaps[g] = slots
+	return slots
+}
+
+func (vm *VM) call(callee obj.Value, args byte) error {
+	switch callee.Type() {
+	case obj.FuncObj:
+	case obj.NativeObj:
+		return vm.callNative(callee.Obj().(*obj.NativeFn), args)
+	default:
+		return fmt.Errorf("%s not callable", callee.Type())
+	}
+
+	fn := callee.Obj().(*obj.Function)
+	if fn.Arity() != int(args) {
+		return fmt.Errorf("%s expects %d arguments, got %d", fn, fn.Arity(), args)
+	}
+
+	if vm.fp+1 == len(vm.frames) {
+		return fmt.Errorf("stack overflow")
+	}
+
+	// Frames are allocated once per depth and reused by later calls.
+	frame := vm.frames[vm.fp+1]
+	if frame == nil {
+		frame = new(CalLFrame)
+		vm.frames[vm.fp+1] = frame
+	}
+
+	base := vm.sp - int(args) - 1
+	*frame = CalLFrame{
 		ip:       0,
 		function: fn,
-		stack:    vm.stack[vm.sp-int(args)-1:],
+		base:     base,
+		stack:    vm.stack[base:],
+	}
+	frame.table, frame.globals = vm.frameGlobals(fn.Globals())
+
+	if vm.hooks.call != nil {
+		vm.hooks.call(fn, vm.stack[base+1:vm.sp])
 	}
 
 	vm.fp += 1
 	vm.currFrame = frame
-	vm.frames[vm.fp] = frame
+
+	if vm.profile != nil {
+		frame.start = time.Now()
+	}
 
 	return nil
 }
+
+func (vm *VM) callNative(fn *obj.NativeFn, args byte) error {
+	base := vm.sp - int(args) - 1
+
+	argv := make([]obj.Obj, args)
+	for i, v := range vm.stack[base+1 : vm.sp] {
+		argv[i] = v.Obj()
+	}
+
+	if vm.hooks.call != nil {
+		vm.hooks.call(fn, vm.stack[base+1:vm.sp])
+	}
+
+	var start time.Time
+	if vm.profile != nil {
+		start = time.Now()
+	}
+
+	res, err := fn.Call(argv)
+	if vm.profile != nil {
+		vm.profileNative(fn, time.Since(start))
+	}
+	if err == errYield {
+		// The call completes when the fiber is resumed, which replaces this
+		// result with the value passed to resume.
+		res = obj.Nil()
+	} else if err != nil {
+		// The call still ends here, so hooks see it return before the
+		// error unwinds the frames that made it.
+		if vm.hooks.ret != nil {
+			vm.hooks.ret(fn, obj.NilVal)
+		}
+		return err
+	}
+
+	if vm.hooks.ret != nil {
+		vm.hooks.ret(fn, obj.ObjVal(res))
+	}
+
+	vm.sp = base
+	vm.push(obj.ObjVal(res))
+	return err
+}